@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 访问日志格式, 可通过 ${字段} 自定义模板
+//
+// 可用字段: time, time_clf, method, uri, path, proto, host, status, bytes, latency, remote, client_ip,
+// user_agent, referer, route, request_id, trace_id, user, upstream
+//
+// latency, upstream 单位为毫秒, user 及 upstream 分别通过 Context.SetLogUser, Context.SetUpstreamTime 设置, user 未设置时使用 Basic 认证用户名
+const (
+	// AccessLogDefault 默认格式
+	AccessLogDefault = `"${time}", "${uri}", "${remote}", "${method}", ${status}, ${latency}, "${request_id}"`
+
+	// AccessLogCommon Apache common log format
+	AccessLogCommon = `${client_ip} - ${user} [${time_clf}] "${method} ${uri} ${proto}" ${status} ${bytes}`
+
+	// AccessLogCombined Apache combined log format
+	AccessLogCombined = AccessLogCommon + ` "${referer}" "${user_agent}"`
+
+	// AccessLogJson 每行一个json对象, 包含所有字段
+	AccessLogJson = "json"
+)
+
+// AccessLogConfig 访问日志配置
+type AccessLogConfig struct {
+	// Format 日志格式: AccessLogDefault, AccessLogCommon, AccessLogCombined, AccessLogJson 或 ${字段} 模板, 为空则使用 AccessLogDefault
+	Format string
+
+	// Exclude 不记录日志的路径正则, 如 ^/health$, ^/static/
+	Exclude []string
+
+	// SampleRate 采样比例 (0, 1), 0 则全部记录, 状态码 >= 500 的请求不进行采样
+	SampleRate float64
+
+	// Logger 日志输出, 为空则使用 GetCleanLogger("access")
+	Logger Logger
+
+	// Disable 关闭访问日志
+	Disable bool
+}
+
+type accessLog struct {
+	conf    AccessLogConfig
+	tokens  []accessLogToken
+	exclude []*regexp.Regexp
+	logger  Logger
+}
+
+// accessLogToken 日志模板片段, field 为 true 时 text 为字段名, 否则为原样输出的文本
+type accessLogToken struct {
+	text  string
+	field bool
+}
+
+// parseAccessLogFormat 将 ${字段} 模板解析为文本及字段片段, 记录日志时一次填充,
+// 请求头等字段值中的 ${...} 不会被再次替换
+func parseAccessLogFormat(format string) []accessLogToken {
+	var tokens []accessLogToken
+	for len(format) > 0 {
+		start := strings.Index(format, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(format[start:], "}")
+		if end < 0 {
+			break
+		}
+		if start > 0 {
+			tokens = append(tokens, accessLogToken{text: format[:start]})
+		}
+		tokens = append(tokens, accessLogToken{text: format[start+2 : start+end], field: true})
+		format = format[start+end+1:]
+	}
+	if len(format) > 0 {
+		tokens = append(tokens, accessLogToken{text: format})
+	}
+	return tokens
+}
+
+// accessRecord 处理器中设置的访问日志字段, 所有 Context 副本共享
+type accessRecord struct {
+	user     string
+	upstream time.Duration
+}
+
+// SetLogUser 设置访问日志中的认证用户
+func (c *Context) SetLogUser(user string) {
+	if c.access != nil {
+		c.access.user = user
+	}
+}
+
+// SetUpstreamTime 设置访问日志中的上游服务耗时
+func (c *Context) SetUpstreamTime(d time.Duration) {
+	if c.access != nil {
+		c.access.upstream = d
+	}
+}
+
+// SetAccessLog 设置访问日志格式, 正则错误时返回 error
+func (t *Server) SetAccessLog(conf AccessLogConfig) error {
+	a := &accessLog{
+		conf:   conf,
+		logger: conf.Logger,
+	}
+	if len(a.conf.Format) <= 0 {
+		a.conf.Format = AccessLogDefault
+	}
+	a.tokens = parseAccessLogFormat(a.conf.Format)
+	if a.logger == nil {
+		a.logger = accessLogger
+	}
+	for _, expr := range conf.Exclude {
+		reg, err := regexp.Compile(expr)
+		if err != nil {
+			return errors.New(fmt.Sprintf("访问日志排除路径正则错误: %v, %v", expr, err.Error()))
+		}
+		a.exclude = append(a.exclude, reg)
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.accessLog = a
+	return nil
+}
+
+// SetAccessLog 设置全局Server访问日志格式
+func SetAccessLog(conf AccessLogConfig) error {
+	return globalServer.SetAccessLog(conf)
+}
+
+// log 请求处理完成后记录访问日志
+func (a *accessLog) log(ctx *Context, start time.Time) {
+	if a == nil || a.conf.Disable {
+		return
+	}
+	for _, reg := range a.exclude {
+		if reg.MatchString(ctx.Request.URL.Path) {
+			return
+		}
+	}
+	status, size := ctx.responseState()
+	if a.conf.SampleRate > 0 && a.conf.SampleRate < 1 && status < StatusInternalServerError && rand.Float64() >= a.conf.SampleRate {
+		return
+	}
+	fields := a.fields(ctx, start, status, size)
+	if a.conf.Format != AccessLogJson {
+		a.logger.Log(a.format(fields))
+		return
+	}
+	res, err := json.Marshal(fields)
+	if err != nil {
+		mLogger.ErrorF("access log json error: %v", err.Error())
+		return
+	}
+	a.logger.Log(string(res))
+}
+
+// format 按模板片段填充字段, 未知字段原样输出
+func (a *accessLog) format(fields map[string]interface{}) string {
+	var buf strings.Builder
+	for _, token := range a.tokens {
+		if !token.field {
+			buf.WriteString(token.text)
+			continue
+		}
+		value, has := fields[token.text]
+		if !has {
+			buf.WriteString("${" + token.text + "}")
+			continue
+		}
+		buf.WriteString(strings.TrimSpace(escapeLogValue(fmt.Sprintf("%v", value))))
+	}
+	return buf.String()
+}
+
+// escapeLogValue 同 nginx, 将 " \ 及不可打印字符转义为 \xXX, 避免请求头中的引号破坏日志格式
+func escapeLogValue(value string) string {
+	var buf strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '"' || c == '\\' || c < 0x20 || c > 0x7e {
+			fmt.Fprintf(&buf, "\\x%02X", c)
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
+
+func (a *accessLog) fields(ctx *Context, start time.Time, status int, size int64) map[string]interface{} {
+	r := ctx.Request
+	record := ctx.access
+	if record == nil {
+		record = &accessRecord{}
+	}
+	fields := map[string]interface{}{
+		"time":       start.Format(TimeFormat),
+		"time_clf":   start.Format("02/Jan/2006:15:04:05 -0700"),
+		"method":     r.Method,
+		"uri":        r.RequestURI,
+		"path":       r.URL.Path,
+		"proto":      r.Proto,
+		"host":       r.Host,
+		"status":     status,
+		"bytes":      size,
+		"latency":    time.Since(start).Milliseconds(),
+		"remote":     r.RemoteAddr,
+		"client_ip":  RateLimitByIp(ctx),
+		"user_agent": r.UserAgent(),
+		"referer":    r.Referer(),
+		"route":      ctx.route,
+		"request_id": ctx.trace.RequestId,
+		"trace_id":   ctx.trace.TraceId,
+		"user":       record.user,
+		"upstream":   record.upstream.Milliseconds(),
+	}
+	if len(record.user) <= 0 {
+		if user, _, ok := r.BasicAuth(); ok {
+			fields["user"] = user
+		}
+	}
+	if a.conf.Format == AccessLogJson {
+		return fields
+	}
+	// 文本格式中空值使用 -
+	for _, key := range []string{"user", "user_agent", "referer", "route"} {
+		if fields[key] == "" {
+			fields[key] = "-"
+		}
+	}
+	if size <= 0 {
+		fields["bytes"] = "-"
+	}
+	return fields
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type captureLogger struct {
+	Logger
+	lines []string
+}
+
+func (l *captureLogger) Log(msg string) {
+	l.lines = append(l.lines, msg)
+}
+
+func TestAccessLog(t *testing.T) {
+	srv := NewServer("", 0)
+	logger := &captureLogger{}
+	err := srv.SetAccessLog(AccessLogConfig{
+		Format:  AccessLogJson,
+		Exclude: []string{"^/health$"},
+		Logger:  logger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.GET("/user/{id}", func(c Context) {
+		c.SetLogUser("admin")
+		c.Response.WriteHeader(StatusCreated)
+		_, _ = c.Response.Write([]byte("created"))
+	})
+	srv.GET("/health", func(c Context) {
+		c.OK(Plain, []byte("ok"))
+	})
+
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, "/health", nil))
+	req := httptest.NewRequest(GET, "/user/1", nil)
+	req.Header.Set(RequestIdHeader, "req-1")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	if len(logger.lines) != 1 {
+		t.Fatalf("access log exclude error: %v", logger.lines)
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal([]byte(logger.lines[0]), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["status"] != float64(StatusCreated) || fields["bytes"] != float64(7) || fields["route"] != "/user/{id}" ||
+		fields["request_id"] != "req-1" || fields["user"] != "admin" {
+		t.Fatalf("access log fields error: %v", fields)
+	}
+
+	if err = srv.SetAccessLog(AccessLogConfig{Format: AccessLogCombined, Logger: logger}); err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest(GET, "/health", nil)
+	req.Header.Set(UserAgent, "test-agent")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	line := logger.lines[len(logger.lines)-1]
+	if !strings.HasPrefix(line, "192.0.2.1 - - [") || !strings.HasSuffix(line, `"GET /health HTTP/1.1" 200 2 "-" "test-agent"`) {
+		t.Fatalf("combined log error: %v", line)
+	}
+
+	req = httptest.NewRequest(GET, "/health", nil)
+	req.Header.Set(UserAgent, `agent" \ "x`)
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	line = logger.lines[len(logger.lines)-1]
+	if !strings.HasSuffix(line, `"-" "agent\x22 \x5C \x22x"`) {
+		t.Fatalf("combined log escape error: %v", line)
+	}
+
+	// 请求头中的 ${...} 原样记录, 不会被替换为其他字段
+	for i := 0; i < 20; i++ {
+		req = httptest.NewRequest(GET, "/health", nil)
+		req.Header.Set(UserAgent, "${uri}")
+		req.Header.Set("Referer", "${status}")
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+		line = logger.lines[len(logger.lines)-1]
+		if !strings.HasSuffix(line, `200 2 "${status}" "${uri}"`) {
+			t.Fatalf("combined log placeholder error: %v", line)
+		}
+	}
+
+	if err = srv.SetAccessLog(AccessLogConfig{Exclude: []string{"("}}); err == nil {
+		t.Fatal("exclude reg error expected")
+	}
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// contextAttrs 请求属性, Context 的副本共享同一份属性
+type contextAttrs struct {
+	sync.RWMutex
+	values  map[string]interface{}
+	session *Session
+}
+
+func (a *contextAttrs) clone() *contextAttrs {
+	res := &contextAttrs{}
+	if a == nil {
+		return res
+	}
+	a.RLock()
+	defer a.RUnlock()
+	res.session = a.session
+	if len(a.values) > 0 {
+		res.values = make(map[string]interface{}, len(a.values))
+		for k, v := range a.values {
+			res.values[k] = v
+		}
+	}
+	return res
+}
+
+// Set 设置请求属性, 用于过滤器及中间件向处理器传递数据, 如登录用户, 租户, 解析后的token
+//
+//	srv.RegisterFilter("/api/", func(c Context) bool {
+//		c.Set("user", user)
+//		return true
+//	})
+//	srv.GET("/api/info", func(c Context) {
+//		user := c.MustGet("user").(*User)
+//	})
+func (c *Context) Set(key string, value interface{}) {
+	if c.attrs == nil {
+		c.attrs = &contextAttrs{}
+	}
+	c.attrs.Lock()
+	defer c.attrs.Unlock()
+	if c.attrs.values == nil {
+		c.attrs.values = map[string]interface{}{}
+	}
+	c.attrs.values[key] = value
+}
+
+// Get 获取请求属性, exists 表示属性是否存在
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	if c.attrs == nil {
+		return nil, false
+	}
+	c.attrs.RLock()
+	defer c.attrs.RUnlock()
+	value, exists = c.attrs.values[key]
+	return
+}
+
+// MustGet 获取请求属性, 不存在则 panic
+func (c *Context) MustGet(key string) interface{} {
+	value, exists := c.Get(key)
+	if !exists {
+		panic(fmt.Sprintf("请求属性 %s 不存在", key))
+	}
+	return value
+}
+
+// Delete 删除请求属性
+func (c *Context) Delete(key string) {
+	if c.attrs == nil {
+		return
+	}
+	c.attrs.Lock()
+	defer c.attrs.Unlock()
+	delete(c.attrs.values, key)
+}
+
+// Keys 请求属性的副本
+func (c *Context) Keys() map[string]interface{} {
+	res := map[string]interface{}{}
+	if c.attrs == nil {
+		return res
+	}
+	c.attrs.RLock()
+	defer c.attrs.RUnlock()
+	for k, v := range c.attrs.values {
+		res[k] = v
+	}
+	return res
+}
+
+// GetString 获取字符串属性, 不存在或类型不符时返回空字符串
+func (c *Context) GetString(key string) string {
+	value, _ := c.Get(key)
+	res, _ := value.(string)
+	return res
+}
+
+// GetInt 获取 int 属性, 不存在或类型不符时返回0
+func (c *Context) GetInt(key string) int {
+	value, _ := c.Get(key)
+	res, _ := value.(int)
+	return res
+}
+
+// GetInt64 获取 int64 属性, 不存在或类型不符时返回0
+func (c *Context) GetInt64(key string) int64 {
+	value, _ := c.Get(key)
+	res, _ := value.(int64)
+	return res
+}
+
+// GetFloat64 获取 float64 属性, 不存在或类型不符时返回0
+func (c *Context) GetFloat64(key string) float64 {
+	value, _ := c.Get(key)
+	res, _ := value.(float64)
+	return res
+}
+
+// GetBool 获取 bool 属性, 不存在或类型不符时返回 false
+func (c *Context) GetBool(key string) bool {
+	value, _ := c.Get(key)
+	res, _ := value.(bool)
+	return res
+}
+
+// GetTime 获取 time.Time 属性, 不存在或类型不符时返回零值
+func (c *Context) GetTime(key string) time.Time {
+	value, _ := c.Get(key)
+	res, _ := value.(time.Time)
+	return res
+}
+
+// GetDuration 获取 time.Duration 属性, 不存在或类型不符时返回0
+func (c *Context) GetDuration(key string) time.Duration {
+	value, _ := c.Get(key)
+	res, _ := value.(time.Duration)
+	return res
+}
+
+// GetStringSlice 获取 []string 属性, 不存在或类型不符时返回 nil
+func (c *Context) GetStringSlice(key string) []string {
+	value, _ := c.Get(key)
+	res, _ := value.([]string)
+	return res
+}
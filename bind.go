@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BindMaxMemory multipart 表单解析时使用的最大内存, 超出部分写入临时文件
+var BindMaxMemory int64 = 32 << 20
+
+// bindTags 数据来源对应的 struct tag, 按顺序填充, 后者覆盖前者
+//
+// json: 请求体json, form: 表单及multipart字段, query: query参数, header: 请求头, path: 路径参数
+var bindTags = []string{"form", "query", "header", "path"}
+
+// Bind 将请求数据填充至结构体并按 validate tag 进行校验
+//
+// dst 需为结构体指针, 字段通过 json, form, query, header, path tag 指定数据来源, 同一字段存在多个来源时, 优先级:
+// path > header > query > form > json
+//
+// 支持 string, int, uint, float, bool, time.Time 及其指针和切片类型, 时间格式可通过 time_format tag 指定
+//
+// 校验失败返回 ValidationErrors, 开启i18n时错误信息通过 validate.${rule} 进行翻译
+func (c *Context) Bind(dst interface{}) error {
+	value := reflect.ValueOf(dst)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return errors.New("bind 参数需为结构体指针")
+	}
+	contentType := strings.ToLower(c.GetContentType())
+	if strings.Contains(contentType, "json") {
+		if body := c.GetBody(); len(body) > 0 {
+			if err := json.Unmarshal(body, dst); err != nil {
+				return err
+			}
+		}
+	}
+	if strings.HasPrefix(contentType, MultipartFormData) {
+		if err := c.Request.ParseMultipartForm(BindMaxMemory); err != nil {
+			return err
+		}
+	} else if strings.HasPrefix(contentType, PostArgsContentType) {
+		if err := c.Request.ParseForm(); err != nil {
+			return err
+		}
+	}
+	var errs ValidationErrors
+	c.bindStruct(value.Elem(), "", &errs)
+	if len(errs) > 0 {
+		return c.translateErrors(errs)
+	}
+	if errs = Validate(dst); len(errs) > 0 {
+		return c.translateErrors(errs)
+	}
+	return nil
+}
+
+// bindValues 获取 tag 对应来源的数据
+func (c *Context) bindValues(tag string, name string) []string {
+	switch tag {
+	case "form":
+		if c.Request.PostForm == nil {
+			return nil
+		}
+		return c.Request.PostForm[name]
+	case "query":
+		return c.Request.URL.Query()[name]
+	case "header":
+		return c.Request.Header.Values(name)
+	case "path":
+		if value, has := c.pathParams[name]; has {
+			return []string{value}
+		}
+	}
+	return nil
+}
+
+func (c *Context) bindStruct(value reflect.Value, prefix string, errs *ValidationErrors) {
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if len(field.PkgPath) > 0 && !field.Anonymous {
+			continue
+		}
+		fieldValue := value.Field(i)
+		if field.Anonymous && fieldValue.Kind() == reflect.Struct {
+			c.bindStruct(fieldValue, prefix, errs)
+			continue
+		}
+		for _, tag := range bindTags {
+			name := tagName(field, tag)
+			if len(name) <= 0 {
+				continue
+			}
+			values := c.bindValues(tag, name)
+			if len(values) <= 0 {
+				continue
+			}
+			if err := setFieldValue(fieldValue, values, field.Tag.Get("time_format")); err != nil {
+				*errs = append(*errs, newFieldError(prefix+fieldName(field), "type", fieldValue.Type().String()))
+			}
+		}
+	}
+}
+
+// tagName 获取字段 tag 中的名称, 忽略 omitempty 等选项
+func tagName(field reflect.StructField, tag string) string {
+	name := strings.Split(field.Tag.Get(tag), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// fieldName 错误信息中的字段名称, 优先使用 tag 中的名称
+func fieldName(field reflect.StructField) string {
+	for _, tag := range append([]string{"json"}, bindTags...) {
+		if name := tagName(field, tag); len(name) > 0 {
+			return name
+		}
+	}
+	return field.Name
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// bindTimeFormats 未指定 time_format 时依次尝试的时间格式
+var bindTimeFormats = []string{time.RFC3339, TimeFormat, "2006-01-02 15:04:05", "2006-01-02"}
+
+func setFieldValue(value reflect.Value, values []string, timeFormat string) error {
+	switch value.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(value.Type().Elem())
+		if err := setFieldValue(elem.Elem(), values, timeFormat); err != nil {
+			return err
+		}
+		value.Set(elem)
+		return nil
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			value.SetBytes([]byte(values[0]))
+			return nil
+		}
+		if len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		slice := reflect.MakeSlice(value.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := setFieldValue(slice.Index(i), []string{strings.TrimSpace(v)}, timeFormat); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+	}
+	return setBasicValue(value, values[0], timeFormat)
+}
+
+func setBasicValue(value reflect.Value, str string, timeFormat string) error {
+	if value.Type() == timeType {
+		formats := bindTimeFormats
+		if len(timeFormat) > 0 {
+			formats = []string{timeFormat}
+		}
+		for _, format := range formats {
+			if t, err := time.ParseInLocation(format, str, time.Local); err == nil {
+				value.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return errors.New(fmt.Sprintf("时间格式错误: %v", str))
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(str)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(str, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(str, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	default:
+		return errors.New(fmt.Sprintf("不支持的类型: %v", value.Type().String()))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindUser struct {
+	Id       int       `path:"id"`
+	Name     string    `json:"name" validate:"required,min=2,max=8"`
+	Email    string    `json:"email" validate:"email"`
+	Role     string    `query:"role" validate:"enum=admin|user"`
+	Tags     []string  `query:"tag"`
+	Active   bool      `query:"active"`
+	Birthday time.Time `query:"birthday" time_format:"2006-01-02"`
+	Token    string    `header:"X-Token" validate:"len=4"`
+	Code     string    `json:"code" validate:"regex=^[a-z]{2},\\d+$"`
+}
+
+func TestBind(t *testing.T) {
+	srv := NewServer("", 0)
+	var user bindUser
+	var bindErr error
+	srv.POST("/user/{id}", func(c Context) {
+		user = bindUser{}
+		bindErr = c.Bind(&user)
+	})
+	post := func(query string, body string) {
+		req := httptest.NewRequest(POST, "/user/12?"+query, strings.NewReader(body))
+		req.Header.Set(ContentType, ApplicationJson)
+		req.Header.Set("X-Token", "abcd")
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	post("role=admin&tag=a,b&active=true&birthday=2020-01-02",
+		`{"name":"james","email":"james@example.com","code":"ab,12"}`)
+	if bindErr != nil {
+		t.Fatal(bindErr)
+	}
+	if user.Id != 12 || user.Name != "james" || user.Role != "admin" || len(user.Tags) != 2 ||
+		!user.Active || user.Birthday.Year() != 2020 || user.Token != "abcd" {
+		t.Fatalf("bind error: %+v", user)
+	}
+
+	post("role=guest&active=yes", `{"name":"j","email":"james","code":"12"}`)
+	errs, ok := bindErr.(ValidationErrors)
+	if !ok {
+		t.Fatalf("validation errors expected: %v", bindErr)
+	}
+	if len(errs) != 1 || errs[0].Field != "active" || errs[0].Rule != "type" {
+		t.Fatalf("type error expected: %+v", errs)
+	}
+
+	post("role=guest", `{"email":"james","code":"12"}`)
+	errs, _ = bindErr.(ValidationErrors)
+	rules := []string{}
+	for _, e := range errs {
+		rules = append(rules, e.Field+":"+e.Rule)
+	}
+	if strings.Join(rules, " ") != "name:required email:email role:enum code:regex" {
+		t.Fatalf("validation errors: %v", rules)
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"time"
+)
+
+/*
+Middleware 中间件, 可在处理器执行前后执行逻辑
+
+next : 执行后续中间件及处理器, 不调用则拦截请求
+
+执行顺序: Server 中间件及过滤器(按注册顺序) > 分组中间件(外层分组优先) > 路由中间件 > 处理器
+*/
+type Middleware func(ctx *Context, next func())
+
+// Use 注册全局中间件, 与 RegisterFilter 注册的过滤器按注册顺序执行
+func (t *Server) Use(middlewares ...Middleware) {
+	t.Lock()
+	defer t.Unlock()
+	for _, m := range middlewares {
+		if m != nil {
+			t.middlewares = append(t.middlewares, m)
+		}
+	}
+}
+
+// Use 注册全局Server中间件
+func Use(middlewares ...Middleware) {
+	globalServer.Use(middlewares...)
+}
+
+// FilterMiddleware 将过滤器转换为中间件
+//
+// handle : return false 拦截请求
+func FilterMiddleware(handle func(Context) bool) Middleware {
+	return FilterFuncMiddleware(WrapFilter(handle))
+}
+
+// FilterFuncMiddleware 将 FilterFunc 过滤器转换为中间件
+func FilterFuncMiddleware(filter FilterFunc) Middleware {
+	return func(ctx *Context, next func()) {
+		if !filter(ctx) {
+			return
+		}
+		next()
+	}
+}
+
+// Timeout 设置请求截止时间, 超时后 Context.Ctx() 被取消
+//
+// 不会中断处理器的执行, 使用 Ctx() 的数据库查询, http请求及kafka发送随之中断, 超时且处理器未写入响应时返回 503
+func Timeout(timeout time.Duration) Middleware {
+	return func(ctx *Context, next func()) {
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+		ctx.Request = ctx.Request.WithContext(timeoutCtx)
+		next()
+		if timeoutCtx.Err() != context.DeadlineExceeded {
+			return
+		}
+		if !ctx.Written() {
+			ctx.Error(StatusServiceUnavailable, "请求超时")
+		}
+	}
+}
+
+// runMiddlewares 依次执行中间件, 最后执行 handler
+func runMiddlewares(ctx *Context, middlewares []Middleware, handler func()) {
+	index := 0
+	var next func()
+	next = func() {
+		if index >= len(middlewares) {
+			handler()
+			return
+		}
+		m := middlewares[index]
+		index++
+		m(ctx, next)
+	}
+	next()
+}
+
+// withMiddlewares 为处理器添加路由中间件
+func withMiddlewares(handler HandlerFunc, middlewares []Middleware) HandlerFunc {
+	if len(middlewares) <= 0 {
+		return handler
+	}
+	return func(ctx *Context) {
+		runMiddlewares(ctx, middlewares, func() {
+			handler(ctx)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	srv := NewServer("", 0)
+	var trace []string
+	mark := func(name string) Middleware {
+		return func(ctx *Context, next func()) {
+			trace = append(trace, name+">")
+			next()
+			trace = append(trace, "<"+name)
+		}
+	}
+	srv.Use(mark("global"))
+	srv.RegisterFilter("/api/", func(Context) bool {
+		trace = append(trace, "filter")
+		return true
+	})
+	api := srv.Group("/api").Use(mark("group"))
+	api.Group("/v1").Use(mark("sub")).GET("/hello", func(Context) {
+		trace = append(trace, "handler")
+	}, mark("route"))
+
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, "/api/v1/hello", nil))
+	expect := "global> filter group> sub> route> handler <route <sub <group <global"
+	if strings.Join(trace, " ") != expect {
+		t.Fatalf("middleware order: %v", strings.Join(trace, " "))
+	}
+
+	trace = nil
+	srv.RegisterFilter("/api/", func(c Context) bool {
+		c.Code(StatusForbidden)
+		return false
+	})
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/api/v1/hello", nil))
+	if w.Code != StatusForbidden || strings.Contains(strings.Join(trace, " "), "handler") {
+		t.Fatalf("filter not intercept: %v %v", w.Code, trace)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+
+	srv := NewServer("", 0)
+	errs := make(chan error, 1)
+	srv.GET("/slow", func(c Context) {
+		_, _, _, err := DoRequestContext(c.Ctx(), 0, GET, upstream.URL, nil, "", nil)
+		errs <- err
+	}, Timeout(50*time.Millisecond))
+	srv.GET("/fast", func(c Context) {
+		if _, has := c.Ctx().Deadline(); !has {
+			t.Error("deadline not set")
+		}
+		c.OK(Plain, []byte("fast"))
+	}, Timeout(time.Second))
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/slow", nil))
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Fatalf("outbound call not canceled: %v", err)
+	}
+	if w.Code != StatusServiceUnavailable || time.Since(start) > 2*time.Second {
+		t.Fatalf("timeout response error: %v %v", w.Code, time.Since(start))
+	}
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/fast", nil))
+	if w.Code != StatusOK || w.Body.String() != "fast" {
+		t.Fatalf("fast response error: %v %v", w.Code, w.Body.String())
+	}
+}
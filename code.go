@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io/fs"
 	"io/ioutil"
-	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -44,6 +43,8 @@ type pageCode struct {
 
 // DistFrontend2Code 将前端编译代码即静态资源直接编译为go代码
 //
+// Deprecated: 使用 //go:embed 及 Server.RegisterFrontendDistFS 代替
+//
 // pkg: 包名 package ${pkg}
 //
 // distPath: 编译代码所在路径
@@ -74,6 +75,8 @@ func DistFrontend2Code(pkg string, distPath string, urlPrefix string) (string, e
 		Package: pkg,
 	}
 	codeBuilder := strings.Builder{}
+	// 变量序号, 保证多次生成的代码一致
+	varIndex := 0
 
 	if err := filepath.Walk(distPath, func(path string, info fs.FileInfo, err error) error {
 		fmt.Printf("开始编译: %v\n", path)
@@ -85,7 +88,8 @@ func DistFrontend2Code(pkg string, distPath string, urlPrefix string) (string, e
 		subPath := strings.Replace(newPath, fmt.Sprintf("%v/", distPath), "", 1)
 		if info.IsDir() {
 			if indexContent, err := os.ReadFile(fmt.Sprintf("%v%vindex.html", path, string(os.PathSeparator))); err == nil {
-				name := fmt.Sprintf("var_rand_%v", rand.Int()) + strings.ReplaceAll(strings.ReplaceAll(info.Name(), ".", "_"), "-", "_")
+				varIndex++
+				name := fmt.Sprintf("var_%v_", varIndex) + strings.ReplaceAll(strings.ReplaceAll(info.Name(), ".", "_"), "-", "_")
 				codeBuilder.WriteString(StringFormatStructs(varTpl, distVar{
 					Name:        name,
 					Value:       base64.StdEncoding.EncodeToString(indexContent),
@@ -121,7 +125,8 @@ func DistFrontend2Code(pkg string, distPath string, urlPrefix string) (string, e
 			return nil
 		}
 
-		name := fmt.Sprintf("var_rand_%v", rand.Int()) +
+		varIndex++
+		name := fmt.Sprintf("var_%v_", varIndex) +
 			strings.ReplaceAll(strings.ReplaceAll(info.Name(), ".", "_"), "-", "_")
 		if subPath == "index.html" {
 			name = "index_html"
@@ -129,8 +134,7 @@ func DistFrontend2Code(pkg string, distPath string, urlPrefix string) (string, e
 		url := fmt.Sprintf("%v%v", urlPrefix, subPath)
 		contentType := http.DetectContentType(content)
 		switch Ext(path) {
-		case ".js":
-		case ".jsx":
+		case ".js", ".jsx":
 			contentType = Js
 			break
 		case ".svg":
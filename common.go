@@ -51,6 +51,7 @@ const (
 	POST                = "POST"
 	PUT                 = "PUT"
 	DELETE              = "DELETE"
+	PATCH               = "PATCH"
 	OPTIONS             = "OPTIONS"
 	EXPECT              = "EXPECT"
 	Connection          = "Connection"
@@ -67,6 +68,7 @@ const (
 	Cookie              = "Cookie"
 	SetCookie           = "Set-Cookie"
 	Location            = "Location"
+	Allow               = "Allow"
 	IfModifiedSince     = "If-Modified-Since"
 	LastModified        = "Last-Modified"
 	AcceptRanges        = "Accept-Ranges"
@@ -95,6 +97,7 @@ const (
 
 const (
 	ApplicationJson   = "application/json; charset=utf-8"
+	ProblemJson       = "application/problem+json; charset=utf-8"
 	Json              = "application/json; charset=utf-8"
 	Css               = "text/css; charset=utf-8"
 	Plain             = "text/plain; charset=utf-8"
@@ -114,7 +117,24 @@ const (
 	AccessControlAllowOrigin  = "Access-Control-Allow-Origin"
 	AccessControlAllowMethods = "Access-Control-Allow-Methods"
 	AccessControlAllowHeaders = "Access-Control-Allow-Headers"
-	METHODS                   = "POST,GET,OPTIONS,DELETE"
+	METHODS                   = "POST,GET,OPTIONS,DELETE,PUT,PATCH,HEAD"
+)
+
+const (
+	AccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	AccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	AccessControlMaxAge           = "Access-Control-Max-Age"
+	AccessControlRequestMethod    = "Access-Control-Request-Method"
+	AccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	Origin                        = "Origin"
+	Vary                          = "Vary"
+)
+
+const (
+	RetryAfter         = "Retry-After"
+	RateLimitLimit     = "RateLimit-Limit"
+	RateLimitRemaining = "RateLimit-Remaining"
+	RateLimitReset     = "RateLimit-Reset"
 )
 
 // HTTP status codes as registered with IANA.
@@ -427,6 +447,8 @@ var SwaggerJs, _ = base64.StdEncoding.DecodeString(`IWZ1bmN0aW9uKGUsdCl7Im9iamVj
 
 var StatusNotFoundView = fmt.Sprintf(StaticHtml, "NOT FOUND", "<h1>404 NOT FOUND</h1>")
 
+var StatusMethodNotAllowedView = fmt.Sprintf(StaticHtml, "METHOD NOT ALLOWED", "<h1>405 METHOD NOT ALLOWED</h1>")
+
 const (
 	red   = "\033[31m"
 	green = "\033[32m"
@@ -0,0 +1,682 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 支持的压缩编码
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingZstd    = "zstd"
+)
+
+// DefaultMaxDecompressSize 请求体解压后的默认最大字节数
+const DefaultMaxDecompressSize = 32 << 20
+
+/*
+CompressConfig 响应压缩配置
+
+Level : 压缩级别, 0 使用各编码的默认级别, 1-9 对应 gzip 级别, zstd 按相近级别转换
+
+MinLength : 小于该字节数的响应不压缩, 0 使用默认值 1024
+
+Encodings : 支持的编码, 客户端 Accept-Encoding 权重相同时按该顺序选择, 为空使用 zstd, gzip, deflate
+
+ExcludeContentTypes : 不压缩的 Content-Type 前缀, 图片, 音视频, 压缩包等已压缩类型默认不压缩
+
+MaxDecompressSize : 请求体解压后的最大字节数, 0 使用 DefaultMaxDecompressSize, 小于0不解压请求体
+*/
+type CompressConfig struct {
+	Level               int
+	MinLength           int
+	Encodings           []string
+	ExcludeContentTypes []string
+	MaxDecompressSize   int64
+}
+
+// DefaultCompressConfig 默认压缩配置
+var DefaultCompressConfig = CompressConfig{}
+
+// compressedContentTypes 已压缩的 Content-Type 前缀
+var compressedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/octet-stream",
+	"application/wasm",
+}
+
+// compressibleImageTypes 可压缩的图片类型
+var compressibleImageTypes = []string{
+	"image/svg+xml",
+	"image/x-icon",
+	"image/vnd.microsoft.icon",
+	"image/bmp",
+}
+
+/*
+Compress 响应压缩中间件, 按请求 Accept-Encoding 协商 gzip, deflate 及 zstd 编码
+
+已设置 Content-Encoding 的响应, 已压缩类型, 小于 MinLength 的响应, HEAD 请求及 206, 204, 304 响应不压缩;
+Flush 时刷新已压缩的数据, 可用于 SSE 等流式响应; 在 Compress 之前调用 BufferResponse 缓存响应时不压缩,
+以便读取原始响应体; 之后的中间件缓存响应时, 缓存中为原始响应体, 处理结束后再压缩
+
+同时解压 Content-Encoding 为 gzip, deflate, zstd 的请求体, 见 Decompress
+
+	srv.Use(Compress(DefaultCompressConfig))
+*/
+func Compress(conf CompressConfig) Middleware {
+	if conf.MinLength <= 0 {
+		conf.MinLength = 1024
+	}
+	if len(conf.Encodings) <= 0 {
+		conf.Encodings = []string{EncodingZstd, EncodingGzip, EncodingDeflate}
+	}
+	if conf.MaxDecompressSize == 0 {
+		conf.MaxDecompressSize = DefaultMaxDecompressSize
+	}
+	pools := map[string]*sync.Pool{}
+	for _, encoding := range conf.Encodings {
+		if pool := newEncoderPool(encoding, conf.Level); pool != nil {
+			pools[encoding] = pool
+		}
+	}
+	var decompress Middleware
+	if conf.MaxDecompressSize > 0 {
+		decompress = Decompress(conf.MaxDecompressSize)
+	}
+	return func(ctx *Context, next func()) {
+		if decompress != nil {
+			decompress(ctx, func() {
+				compressResponse(ctx, &conf, pools, next)
+			})
+			return
+		}
+		compressResponse(ctx, &conf, pools, next)
+	}
+}
+
+func compressResponse(ctx *Context, conf *CompressConfig, pools map[string]*sync.Pool, next func()) {
+	if ctx.GetMethod() == HEAD {
+		next()
+		return
+	}
+	encoding := negotiateEncoding(ctx.GetHeader(AcceptEncoding), conf.Encodings)
+	if len(encoding) <= 0 {
+		// 不支持压缩的客户端同样需要 Vary, 避免缓存返回压缩后的响应
+		ctx.BeforeWrite(func(int) {
+			if len(ctx.Response.Header().Get(ContentEncoding)) <= 0 {
+				addVary(ctx.Response.Header(), AcceptEncoding)
+			}
+		})
+		next()
+		return
+	}
+	original := ctx.Response
+	w := &compressWriter{
+		ResponseWriter: original,
+		ctx:            ctx,
+		conf:           conf,
+		encoding:       encoding,
+		pool:           pools[encoding],
+		status:         StatusOK,
+		outerBuffered:  ctx.writer != nil && ctx.writer.buffering,
+	}
+	ctx.Response = w
+	defer func() {
+		ctx.Response = original
+		if err := w.Close(); err != nil {
+			mLogger.ErrorF("response compress error: %v", err)
+		}
+	}()
+	next()
+	w.completed = true
+}
+
+var errCompressWriterClosed = errors.New("压缩响应已结束")
+
+// compressWriter 首次写入达到 MinLength 或 Flush 时确定是否压缩
+type compressWriter struct {
+	http.ResponseWriter
+	ctx         *Context
+	conf        *CompressConfig
+	encoding    string
+	pool        *sync.Pool
+	encoder     compressEncoder
+	buffer      []byte
+	status      int
+	wroteHeader bool
+	decided     bool
+	hijacked    bool
+	closed      bool
+	// outerBuffered 进入中间件前已缓存响应, 不压缩
+	outerBuffered bool
+	// completed 处理正常结束, panic 时缓存的响应将被丢弃, 不再压缩
+	completed bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader || w.decided {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	if !bodyAllowedForStatus(status) || status == StatusPartialContent {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.closed {
+		return 0, errCompressWriterClosed
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+	if w.innerBuffering() {
+		// 之后的中间件缓存响应, 原始数据写入缓存, 处理结束后再压缩
+		return w.writeThrough(data)
+	}
+	w.buffer = append(w.buffer, data...)
+	compress := true
+	if len(w.buffer) < w.conf.MinLength {
+		length, err := strconv.Atoi(w.Header().Get("Content-Length"))
+		if err != nil || length >= w.conf.MinLength {
+			// 长度未知时缓存至 MinLength 再确定
+			return len(data), nil
+		}
+		compress = false
+	}
+	if err := w.start(compress && w.shouldCompress()); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Flush 确定是否压缩并刷新已压缩的数据
+func (w *compressWriter) Flush() {
+	if w.closed {
+		return
+	}
+	if !w.decided {
+		if !w.wroteHeader {
+			w.WriteHeader(StatusOK)
+		}
+		if w.innerBuffering() {
+			// 缓存响应时 Flush 不生效
+			if _, err := w.writeThrough(nil); err != nil {
+				mLogger.ErrorF("response compress error: %v", err)
+			}
+			return
+		}
+		if err := w.start(w.shouldCompress()); err != nil {
+			mLogger.ErrorF("response compress error: %v", err)
+			return
+		}
+	}
+	if w.encoder != nil {
+		if err := w.encoder.Flush(); err != nil {
+			mLogger.ErrorF("response compress error: %v", err)
+			return
+		}
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack 支持 websocket 等协议升级
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response 不支持 Hijack")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Push 支持 HTTP/2 服务端推送, 不支持时返回 http.ErrNotSupported
+func (w *compressWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap 返回原始 ResponseWriter, 供 http.ResponseController 使用
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// wroteStatus 未达到 MinLength 时状态码及数据暂存在 compressWriter 中
+func (w *compressWriter) wroteStatus() (int, bool) {
+	return w.status, w.wroteHeader
+}
+
+// resetStatus 清空暂存的数据, 已开始压缩时响应头已发送, 不会被调用
+func (w *compressWriter) resetStatus() {
+	w.wroteHeader = false
+	w.status = StatusOK
+	w.buffer = nil
+	if w.encoder == nil {
+		w.decided = false
+	}
+}
+
+// Close 写入缓存的数据并结束压缩, 编码器放回对象池
+func (w *compressWriter) Close() error {
+	if w.closed || w.hijacked {
+		return nil
+	}
+	if !w.decided {
+		if !w.wroteHeader {
+			// 未写入响应, 由后续处理写入
+			w.closed = true
+			return nil
+		}
+		var err error
+		if w.completed && w.innerBuffering() {
+			err = w.compressBuffered()
+		} else {
+			err = w.start(false)
+		}
+		if err != nil {
+			w.closed = true
+			return err
+		}
+	}
+	w.closed = true
+	if w.encoder == nil {
+		return nil
+	}
+	err := w.encoder.Close()
+	w.encoder.Reset(nil)
+	w.pool.Put(w.encoder)
+	w.encoder = nil
+	return err
+}
+
+// shouldCompress 根据响应头判断是否压缩, 未设置 Content-Type 时按已写入的数据识别
+func (w *compressWriter) shouldCompress() bool {
+	header := w.Header()
+	if len(header.Get(ContentEncoding)) > 0 || len(header.Get("Content-Range")) > 0 {
+		return false
+	}
+	if !bodyAllowedForStatus(w.status) || w.status == StatusPartialContent {
+		return false
+	}
+	if w.outerBuffered {
+		return false
+	}
+	contentType := header.Get(ContentType)
+	if len(contentType) <= 0 && len(w.buffer) > 0 {
+		contentType = http.DetectContentType(w.buffer)
+		header.Set(ContentType, contentType)
+	}
+	if !compressibleContentType(contentType, w.conf.ExcludeContentTypes) {
+		return false
+	}
+	addVary(header, AcceptEncoding)
+	return w.pool != nil
+}
+
+// start 写入响应头及缓存的数据, compress 为 true 时之后的数据经压缩写入
+func (w *compressWriter) start(compress bool) error {
+	w.decide(compress)
+	if len(w.buffer) <= 0 {
+		return nil
+	}
+	data := w.buffer
+	w.buffer = nil
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(data)
+	} else {
+		_, err = w.ResponseWriter.Write(data)
+	}
+	return err
+}
+
+// innerBuffering 之后的中间件调用了 BufferResponse, 响应尚未发送
+func (w *compressWriter) innerBuffering() bool {
+	writer := w.ctx.writer
+	return !w.outerBuffered && writer != nil && writer.buffering && !writer.headerSent
+}
+
+// writeThrough 暂不确定是否压缩, 将状态码及数据直接写入缓存
+func (w *compressWriter) writeThrough(data []byte) (int, error) {
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buffer) > 0 {
+		buffered := w.buffer
+		w.buffer = nil
+		if _, err := w.ResponseWriter.Write(buffered); err != nil {
+			return 0, err
+		}
+	}
+	if len(data) <= 0 {
+		return 0, nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// compressBuffered 处理结束时按完整的缓存数据确定是否压缩, 压缩后替换缓存
+func (w *compressWriter) compressBuffered() error {
+	writer := w.ctx.writer
+	w.buffer = append(append([]byte(nil), writer.buffer.Bytes()...), w.buffer...)
+	writer.buffer.Reset()
+	return w.start(len(w.buffer) >= w.conf.MinLength && w.shouldCompress())
+}
+
+func (w *compressWriter) decide(compress bool) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	if compress {
+		header := w.Header()
+		header.Set(ContentEncoding, w.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		// 压缩后的内容与原内容不同, 强校验 ETag 改为弱校验
+		if etag := header.Get("Etag"); len(etag) > 0 && !strings.HasPrefix(etag, "W/") {
+			header.Set("Etag", "W/"+etag)
+		}
+		w.encoder = w.pool.Get().(compressEncoder)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// bodyAllowedForStatus 该状态码的响应是否可以包含响应体
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == StatusNoContent:
+		return false
+	case status == StatusNotModified:
+		return false
+	}
+	return true
+}
+
+func compressibleContentType(contentType string, excludes []string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if len(contentType) <= 0 {
+		return false
+	}
+	for _, prefix := range excludes {
+		if strings.HasPrefix(contentType, strings.ToLower(prefix)) {
+			return false
+		}
+	}
+	for _, prefix := range compressibleImageTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	for _, prefix := range compressedContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// addVary 添加 Vary 响应头, 已存在时不重复添加
+func addVary(header http.Header, value string) {
+	for _, line := range header.Values(Vary) {
+		for _, item := range strings.Split(line, ",") {
+			item = strings.TrimSpace(item)
+			if item == "*" || strings.EqualFold(item, value) {
+				return
+			}
+		}
+	}
+	header.Add(Vary, value)
+}
+
+// negotiateEncoding 按 Accept-Encoding 的权重选择编码, 权重相同时按 encodings 顺序, 均不支持时返回空
+func negotiateEncoding(acceptEncoding string, encodings []string) string {
+	if len(strings.TrimSpace(acceptEncoding)) <= 0 {
+		return ""
+	}
+	weights := map[string]float64{}
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if len(name) <= 0 {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.ReplaceAll(strings.TrimSpace(param), " ", "")
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = value
+				}
+			}
+		}
+		if name == "x-gzip" {
+			name = EncodingGzip
+		}
+		weights[name] = q
+	}
+	type candidate struct {
+		encoding string
+		q        float64
+		index    int
+	}
+	var candidates []candidate
+	for i, encoding := range encodings {
+		q, has := weights[encoding]
+		if !has {
+			q, has = weights["*"]
+		}
+		if has && q > 0 {
+			candidates = append(candidates, candidate{encoding: encoding, q: q, index: i})
+		}
+	}
+	if len(candidates) <= 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].encoding
+}
+
+// compressEncoder 可复用的压缩编码器
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// zstdEncoder Reset 为 nil 时释放对底层 Writer 的引用
+type zstdEncoder struct {
+	*zstd.Encoder
+}
+
+func (e zstdEncoder) Reset(w io.Writer) {
+	if w == nil {
+		w = io.Discard
+	}
+	e.Encoder.Reset(w)
+}
+
+func newEncoderPool(encoding string, level int) *sync.Pool {
+	switch encoding {
+	case EncodingGzip:
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression || level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return &sync.Pool{New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(nil, level)
+			return w
+		}}
+	case EncodingDeflate:
+		if level < flate.HuffmanOnly || level > flate.BestCompression || level == 0 {
+			level = flate.DefaultCompression
+		}
+		return &sync.Pool{New: func() interface{} {
+			w, _ := zlib.NewWriterLevel(nil, level)
+			return w
+		}}
+	case EncodingZstd:
+		zstdLevel := zstd.SpeedDefault
+		if level > 0 {
+			zstdLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		return &sync.Pool{New: func() interface{} {
+			w, _ := zstd.NewWriter(nil,
+				zstd.WithEncoderLevel(zstdLevel),
+				zstd.WithEncoderConcurrency(1),
+				zstd.WithWindowSize(1<<20),
+				zstd.WithLowerEncoderMem(true))
+			return zstdEncoder{w}
+		}}
+	}
+	mLogger.WarnF("不支持的压缩编码: %s", encoding)
+	return nil
+}
+
+// decompressBody 解压后的请求体, 超出大小限制时标记
+type decompressBody struct {
+	reader   io.Reader
+	closers  []func() error
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func (b *decompressBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, errRequestBodyTooLarge
+	}
+	if int64(len(p)) > b.limit-b.read+1 {
+		p = p[:b.limit-b.read+1]
+	}
+	n, err := b.reader.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		b.exceeded = true
+		return n - int(b.read-b.limit), errRequestBodyTooLarge
+	}
+	return n, err
+}
+
+func (b *decompressBody) Close() error {
+	var res error
+	for _, closer := range b.closers {
+		if err := closer(); err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
+
+var errRequestBodyTooLarge = errors.New("请求体解压后超出大小限制")
+
+/*
+Decompress 请求体解压中间件, 解压 Content-Encoding 为 gzip, deflate, zstd 的请求体, GetBody, GetJSON 等读取解压后的数据
+
+maxSize : 解压后的最大字节数, 防止压缩炸弹, 小于等于0使用 DefaultMaxDecompressSize; 超出时读取返回错误, 处理器未写入响应时返回 413
+
+不支持的编码返回 415, 数据格式错误返回 400
+*/
+func Decompress(maxSize int64) Middleware {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDecompressSize
+	}
+	return func(ctx *Context, next func()) {
+		encoding := strings.ToLower(strings.TrimSpace(ctx.Request.Header.Get(ContentEncoding)))
+		if len(encoding) <= 0 || encoding == "identity" || ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+			next()
+			return
+		}
+		original := ctx.Request.Body
+		body := &decompressBody{
+			limit:   maxSize,
+			closers: []func() error{original.Close},
+		}
+		switch encoding {
+		case EncodingGzip, "x-gzip":
+			reader, err := gzip.NewReader(original)
+			if err != nil {
+				ctx.Error(StatusBadRequest, "请求体解压失败")
+				return
+			}
+			body.reader = reader
+			body.closers = append(body.closers, reader.Close)
+		case EncodingDeflate:
+			reader, err := zlib.NewReader(original)
+			if err != nil {
+				ctx.Error(StatusBadRequest, "请求体解压失败")
+				return
+			}
+			body.reader = reader
+			body.closers = append(body.closers, reader.Close)
+		case EncodingZstd:
+			reader, err := zstd.NewReader(original,
+				zstd.WithDecoderConcurrency(1),
+				zstd.WithDecoderLowmem(true),
+				zstd.WithDecoderMaxMemory(uint64(maxSize)))
+			if err != nil {
+				ctx.Error(StatusBadRequest, "请求体解压失败")
+				return
+			}
+			body.reader = reader
+			body.closers = append(body.closers, func() error {
+				reader.Close()
+				return nil
+			})
+		default:
+			ctx.Error(StatusUnsupportedMediaType, "不支持的请求体编码: "+encoding)
+			return
+		}
+		ctx.Request.Body = body
+		ctx.Request.Header.Del(ContentEncoding)
+		ctx.Request.Header.Del("Content-Length")
+		ctx.Request.ContentLength = -1
+		defer body.Close()
+		next()
+		if body.exceeded && !ctx.Written() {
+			ctx.Error(StatusRequestEntityTooLarge, "请求体超出大小限制")
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressResponse(t *testing.T) {
+	srv := NewServer("", 0)
+	srv.Use(Compress(DefaultCompressConfig))
+	payload := strings.Repeat(`{"name":"middleware"},`, 200)
+	srv.Route(GET, "/json", func(c *Context) {
+		c.SetHeader("Etag", `"v1"`)
+		c.OK(ApplicationJson, []byte(payload))
+	})
+	srv.Route(GET, "/small", func(c *Context) {
+		c.OK(Plain, []byte("small"))
+	})
+	srv.Route(GET, "/png", func(c *Context) {
+		c.OK("image/png", []byte(payload))
+	})
+	srv.Route(GET, "/encoded", func(c *Context) {
+		c.SetHeader(ContentEncoding, EncodingGzip)
+		c.OK(Plain, []byte(payload))
+	})
+
+	request := func(path string, acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(GET, path, nil)
+		r.Header.Set(AcceptEncoding, acceptEncoding)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("/json", "gzip, deflate")
+	if w.Header().Get(ContentEncoding) != EncodingGzip || w.Header().Get(Vary) != AcceptEncoding || w.Header().Get("Etag") != `W/"v1"` {
+		t.Fatalf("gzip response header error: %v", w.Header())
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(reader); string(data) != payload {
+		t.Fatalf("gzip response body error: %q", data)
+	}
+
+	w = request("/json", "gzip;q=0.8, zstd, br")
+	if w.Header().Get(ContentEncoding) != EncodingZstd {
+		t.Fatalf("zstd not negotiated: %v", w.Header())
+	}
+	decoder, _ := zstd.NewReader(w.Body)
+	defer decoder.Close()
+	if data, _ := ioutil.ReadAll(decoder); string(data) != payload {
+		t.Fatalf("zstd response body error: %q", data)
+	}
+
+	for path, acceptEncoding := range map[string]string{"/small": "gzip", "/png": "gzip", "/json": "gzip;q=0, identity"} {
+		w = request(path, acceptEncoding)
+		if len(w.Header().Get(ContentEncoding)) > 0 {
+			t.Fatalf("%v should not be compressed: %v", path, w.Header())
+		}
+	}
+	w = request("/json", "identity")
+	if w.Header().Get(Vary) != AcceptEncoding || w.Body.String() != payload {
+		t.Fatalf("uncompressed response error: %v", w.Header())
+	}
+	w = request("/encoded", "zstd")
+	if w.Header().Get(ContentEncoding) != EncodingGzip || w.Body.String() != payload {
+		t.Fatalf("encoded response should be sent as is: %v", w.Header())
+	}
+}
+
+func TestCompressStream(t *testing.T) {
+	release := make(chan struct{})
+	srv := NewServer("", 0)
+	srv.Use(Compress(DefaultCompressConfig))
+	srv.Route(GET, "/events", func(c *Context) {
+		c.SetHeader(ContentType, EventStream)
+		_, _ = c.Response.Write([]byte("data: first\n\n"))
+		c.Response.(http.Flusher).Flush()
+		<-release
+	})
+	server := httptest.NewServer(srv)
+	defer server.Close()
+	defer close(release)
+
+	req, _ := http.NewRequest(GET, server.URL+"/events", nil)
+	req.Header.Set(AcceptEncoding, EncodingGzip)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get(ContentEncoding) != EncodingGzip {
+		t.Fatalf("stream not compressed: %v", resp.Header)
+	}
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil || line != "data: first\n" {
+		t.Fatalf("stream event error: %q %v", line, err)
+	}
+}
+
+func TestDecompressRequest(t *testing.T) {
+	srv := NewServer("", 0)
+	srv.Use(Compress(CompressConfig{MaxDecompressSize: 1024}))
+	srv.Route(POST, "/json", func(c *Context) {
+		data, err := c.GetJSON()
+		if err != nil {
+			t.Errorf("decompressed json error: %v", err)
+		}
+		c.OK(Plain, []byte(GetJsonParamStr("name", data)))
+	})
+	srv.Route(POST, "/body", func(c *Context) {
+		if c.GetBody() != nil {
+			c.OK(Plain, []byte("read"))
+		}
+	})
+
+	gzipBody := func(data string) *bytes.Buffer {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		_, _ = writer.Write([]byte(data))
+		_ = writer.Close()
+		return &buf
+	}
+	request := func(path string, encoding string, body *bytes.Buffer) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(POST, path, body)
+		r.Header.Set(ContentEncoding, encoding)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("/json", EncodingGzip, gzipBody(`{"name":"middleware"}`)); w.Body.String() != "middleware" {
+		t.Fatalf("gzip request body error: %v %q", w.Code, w.Body.String())
+	}
+	if w := request("/body", EncodingGzip, gzipBody(strings.Repeat("0", 1<<20))); w.Code != StatusRequestEntityTooLarge {
+		t.Fatalf("decompressed size not limited: %v", w.Code)
+	}
+	if w := request("/body", EncodingGzip, bytes.NewBufferString("plain")); w.Code != StatusBadRequest {
+		t.Fatalf("invalid gzip body: %v", w.Code)
+	}
+	if w := request("/body", "br", bytes.NewBufferString("data")); w.Code != StatusUnsupportedMediaType {
+		t.Fatalf("unsupported encoding: %v", w.Code)
+	}
+}
+
+func TestCompressWritten(t *testing.T) {
+	srv := NewServer("", 0)
+	srv.Use(Compress(CompressConfig{MaxDecompressSize: -1}))
+	var written bool
+	var status int
+	srv.Route(GET, "/late", func(c *Context) {
+		time.Sleep(20 * time.Millisecond)
+		c.OK(Plain, []byte("ok"))
+	}, Timeout(10*time.Millisecond))
+	srv.Route(GET, "/created", func(c *Context) {
+		c.Response.WriteHeader(StatusCreated)
+		_, _ = c.Response.Write([]byte("created"))
+	}, func(c *Context, next func()) {
+		next()
+		written, status = c.Written(), c.Status()
+	})
+	srv.Route(POST, "/body", func(c *Context) {
+		if c.GetBody() == nil {
+			c.Error(StatusBadRequest, "bad body")
+		}
+	}, Decompress(16))
+
+	// 暂存在压缩层的响应视为已写入, 超时后不再追加 503
+	r := httptest.NewRequest(GET, "/late", nil)
+	r.Header.Set(AcceptEncoding, EncodingGzip)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	if w.Code != StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("timeout after write error: %v %q", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest(GET, "/created", nil)
+	r.Header.Set(AcceptEncoding, EncodingGzip)
+	srv.ServeHTTP(httptest.NewRecorder(), r)
+	if !written || status != StatusCreated {
+		t.Fatalf("compressed response state error: %v %v", written, status)
+	}
+
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	_, _ = writer.Write([]byte(strings.Repeat("0", 1024)))
+	_ = writer.Close()
+	r = httptest.NewRequest(POST, "/body", &body)
+	r.Header.Set(ContentEncoding, EncodingGzip)
+	r.Header.Set(AcceptEncoding, EncodingGzip)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	if w.Code != StatusBadRequest || w.Body.String() != "bad body" {
+		t.Fatalf("decompress limit response error: %v %q", w.Code, w.Body.String())
+	}
+}
@@ -1,13 +1,17 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"io/ioutil"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,6 +27,41 @@ type Context struct {
 	Message        I18n
 	EnableI18n     bool
 	pathParams     map[string]string
+	route          string
+	trace          TraceContext
+	access         *accessRecord
+	upload         *UploadConfig
+	attrs          *contextAttrs
+	writer         *responseWriter
+	limits         *limitMetrics
+}
+
+// HandlerFunc 处理器, Context 以指针在过滤器, 中间件及处理器之间传递, 过滤器中设置的属性及状态对处理器可见
+type HandlerFunc func(c *Context)
+
+// FilterFunc 过滤器, return false 拦截请求
+type FilterFunc func(c *Context) bool
+
+// WrapHandler 将 func(Context) 处理器转换为 HandlerFunc
+//
+// 处理器收到 Context 的副本, 副本与原 Context 共享 Set 设置的属性
+func WrapHandler(handler func(Context)) HandlerFunc {
+	if handler == nil {
+		return nil
+	}
+	return func(c *Context) {
+		handler(*c)
+	}
+}
+
+// WrapFilter 将 func(Context) bool 过滤器转换为 FilterFunc
+func WrapFilter(filter func(Context) bool) FilterFunc {
+	if filter == nil {
+		return nil
+	}
+	return func(c *Context) bool {
+		return filter(*c)
+	}
 }
 
 type I18n struct {
@@ -30,6 +69,18 @@ type I18n struct {
 	En map[string]string
 }
 
+// RoutePattern 请求匹配的路由注册路径, 如 /user/{id}, 未匹配路由时为空
+func (c *Context) RoutePattern() string {
+	return c.route
+}
+
+// Ctx 请求对应的 context.Context, 客户端断开或超过 Timeout 设置的截止时间后取消, 包含追踪信息
+//
+// 用于 Database.QueryContext, DoRequestContext, MessageHandler.SendContext 等调用, 请求取消后下游调用随之中断
+func (c *Context) Ctx() context.Context {
+	return c.Request.Context()
+}
+
 func (c *Context) GetPathParam(key string) string {
 	value, ok := c.pathParams[key]
 	if ok {
@@ -137,27 +188,41 @@ func (c *Context) Redirect(path string) error {
 	return nil
 }
 
+// ProxyPass 将请求流式转发至 path, path 为完整的上游地址, 未包含query参数时使用请求的query参数
+//
+// timeoutSeconds 为整个请求的超时时间, 0 则不限制, 多个上游服务, 健康检查及重试请使用 RegisterProxy
 func (c *Context) ProxyPass(path string, timeoutSeconds int) {
-	client := http.Client{
-		Timeout: time.Second * time.Duration(timeoutSeconds),
+	if !c.writeable {
+		mLogger.Error("禁止重复写入response")
+		return
 	}
-	req, _ := http.NewRequest(strings.ToUpper(c.GetMethod()), path, c.Request.Body)
-	req.Header = c.Request.Header.Clone()
-	resp, err := client.Do(req)
+	target, err := url.Parse(path)
 	if err != nil {
-		c.Error(500, err.Error())
+		c.Error(StatusBadGateway, err.Error())
 		return
 	}
-	for k, _ := range resp.Header {
-		c.SetHeader(k, resp.Header.Get(k))
+	if len(target.RawQuery) <= 0 {
+		target.RawQuery = c.Request.URL.RawQuery
 	}
-	bodyStr := ""
-	body, err := ioutil.ReadAll(resp.Body)
-	if err == nil {
-		bodyStr = string(body)
+	c.writeable = false
+	req := c.Request
+	if timeoutSeconds > 0 {
+		timeoutCtx, cancel := context.WithTimeout(req.Context(), time.Second*time.Duration(timeoutSeconds))
+		defer cancel()
+		req = req.WithContext(timeoutCtx)
 	}
-	c.Error(resp.StatusCode, bodyStr)
-	return
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			setForwardedHeaders(req, false)
+			req.URL = target
+			req.Host = target.Host
+		},
+		Transport:    defaultProxyTransport,
+		ErrorHandler: proxyErrorHandler,
+	}
+	start := time.Now()
+	proxy.ServeHTTP(c.Response, req)
+	c.SetUpstreamTime(time.Since(start))
 }
 
 // 返回http: 200
@@ -219,15 +284,97 @@ func (c *Context) DelHeader(key string) {
 }
 
 func newContext(w http.ResponseWriter, r *http.Request) Context {
+	writer := wrapResponseWriter(w)
 	return Context{
 		EnableI18n: false,
 		writeable:  true,
-		Response:   w,
+		Response:   writer,
 		Request:    r,
 		pathParams: map[string]string{},
+		attrs:      &contextAttrs{},
+		writer:     writer,
 	}
 }
 
+// wrapResponseWriter 包装 ResponseWriter 以记录实际写入的状态码及字节数
+func wrapResponseWriter(w http.ResponseWriter) *responseWriter {
+	if writer, ok := w.(*responseWriter); ok {
+		return writer
+	}
+	return newResponseWriter(w)
+}
+
+var contextPool = sync.Pool{
+	New: func() interface{} {
+		return &Context{}
+	},
+}
+
+// acquireContext 从对象池获取 Context, 请求结束后由 releaseContext 放回
+func acquireContext(w http.ResponseWriter, r *http.Request) *Context {
+	c := contextPool.Get().(*Context)
+	writer := wrapResponseWriter(w)
+	*c = Context{
+		writeable: true,
+		Response:  writer,
+		Request:   r,
+		attrs:     &contextAttrs{},
+		writer:    writer,
+	}
+	return c
+}
+
+// releaseContext 清空 Context 并放回对象池, 之后不能再使用该 Context
+//
+// 属性及会话每个请求单独分配, 请求结束后仍持有的值副本不会读取到后续请求的数据
+func releaseContext(c *Context) {
+	*c = Context{}
+	contextPool.Put(c)
+}
+
+// Copy 复制 Context, 用于请求结束后仍在其他 goroutine 中使用的场景
+//
+// Context 在请求结束后被回收复用, 启动的 goroutine 需使用 Copy 返回的副本, 副本不能写入响应
+func (c *Context) Copy() *Context {
+	cp := *c
+	cp.writeable = false
+	cp.attrs = c.attrs.clone()
+	pathParams := make(map[string]string, len(c.pathParams))
+	for k, v := range c.pathParams {
+		pathParams[k] = v
+	}
+	cp.pathParams = pathParams
+	return &cp
+}
+
+// Written 响应状态码是否已写入, 包括压缩等中间件包装层暂存的响应, 缓存响应时尚未发送至客户端
+func (c *Context) Written() bool {
+	if c.writer != nil {
+		if c.writer.wroteHeader {
+			return true
+		}
+		for _, wrapped := range c.wrappedWriters() {
+			if _, written := wrapped.wroteStatus(); written {
+				return true
+			}
+		}
+		return false
+	}
+	return !c.writeable
+}
+
+// Status 响应状态码, 已写入时为实际写入的状态码
+func (c *Context) Status() int {
+	status, _ := c.responseState()
+	return status
+}
+
+// Size 已写入的响应体字节数
+func (c *Context) Size() int64 {
+	_, size := c.responseState()
+	return size
+}
+
 // GetMethod 获取http方法
 func (c *Context) GetMethod() string {
 	return c.Request.Method
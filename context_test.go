@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextAttributes(t *testing.T) {
+	srv := NewServer("", 0)
+	srv.RegisterFilter("/api/", func(c Context) bool {
+		c.Set("user", "tom")
+		return true
+	})
+	api := srv.Group("/api")
+	api.FilterFunc(func(c *Context) bool {
+		c.Set("tenant", c.MustGet("user").(string)+"-tenant")
+		return true
+	})
+	var written bool
+	var status int
+	var size int64
+	api.Route(GET, "/pointer", func(c *Context) {
+		if _, exists := c.Get("missing"); exists {
+			t.Errorf("missing attribute exists")
+		}
+		c.OK(Plain, []byte(c.GetString("user")))
+		written, status, size = c.Written(), c.Status(), c.Size()
+	})
+	srv.Route(GET, "/panic", func(c *Context) {
+		c.MustGet("missing")
+	})
+
+	// 值传递的处理器与过滤器共享属性
+	w := httptest.NewRecorder()
+	api.GET("/typed", func(c Context) {
+		c.OK(Plain, []byte(c.GetString("user")))
+		if c.GetString("tenant") != "tom-tenant" || c.GetInt("tenant") != 0 {
+			t.Errorf("typed attribute error: %v", c.Keys())
+		}
+	})
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/api/typed", nil))
+	if w.Body.String() != "tom" {
+		t.Fatalf("value handler attribute error: %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/api/pointer", nil))
+	if w.Body.String() != "tom" || !written || status != StatusOK || size != 3 {
+		t.Fatalf("pointer handler error: %q %v %v %v", w.Body.String(), written, status, size)
+	}
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/panic", nil))
+	if w.Code != StatusInternalServerError {
+		t.Fatalf("MustGet should panic: %v", w.Code)
+	}
+
+	// 回收后的 Context 不保留上一请求的属性
+	w = httptest.NewRecorder()
+	srv.Route(GET, "/clean", func(c *Context) {
+		if len(c.Keys()) > 0 {
+			t.Errorf("pooled context not reset: %v", c.Keys())
+		}
+		c.OK(Plain, []byte("ok"))
+	})
+	for i := 0; i < 10; i++ {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, "/api/typed", nil))
+		srv.ServeHTTP(w, httptest.NewRequest(GET, "/clean", nil))
+	}
+}
+
+func TestContextCopy(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := newContext(newResponseWriter(w), httptest.NewRequest(GET, "/", nil))
+	c.Set("user", "tom")
+	cp := c.Copy()
+	releaseContext(&c)
+	if cp.GetString("user") != "tom" || c.GetString("user") != "" {
+		t.Fatalf("copy attribute error: %v %v", cp.Keys(), c.Keys())
+	}
+	cp.OK(Plain, []byte("data"))
+	if cp.Written() || w.Body.Len() > 0 {
+		t.Fatalf("copy should not write response")
+	}
+}
+
+func TestContextOutlivesRequest(t *testing.T) {
+	srv := NewServer("", 0)
+	release := make(chan struct{})
+	result := make(chan string, 1)
+	srv.GET("/async", func(c Context) {
+		user := c.GetQueryParam("user")
+		c.Set("user", user)
+		c.SessionSet("user", user)
+		if user != "tom" {
+			c.OK(Plain, []byte(user))
+			return
+		}
+		// 值副本在请求结束后仍被 goroutine 持有
+		go func() {
+			<-release
+			result <- fmt.Sprintf("%v %v", c.GetString("user"), c.SessionGet("user"))
+		}()
+		c.OK(Plain, []byte(user))
+	})
+
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, "/async?user=tom", nil))
+	for i := 0; i < 10; i++ {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, "/async?user=jerry", nil))
+	}
+	close(release)
+	if res := <-result; res != "tom tom" {
+		t.Fatalf("goroutine read other request data: %v", res)
+	}
+}
@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CorsPolicy 跨域策略
+//
+// 可通过 Server.SetCors, Group.Cors, Server.RouteCors 分别设置服务, 分组及路由的策略, 优先级: 路由 > 分组 > 服务
+//
+// 预检请求(OPTIONS 且携带 Origin 及 Access-Control-Request-Method 头)在中间件之前直接返回,
+// 普通 OPTIONS 请求按正常路由处理
+type CorsPolicy struct {
+	// AllowOrigins 允许的来源, 如 https://example.com, * 表示允许所有来源, 开启 AllowCredentials 时 * 不生效
+	AllowOrigins []string
+
+	// AllowOriginReg 允许的来源正则
+	AllowOriginReg *regexp.Regexp
+
+	// AllowOriginFunc 自定义来源校验, return true 允许
+	AllowOriginFunc func(origin string) bool
+
+	// AllowMethods 允许的http方法, 为空则使用路由已注册的方法
+	AllowMethods []string
+
+	// AllowHeaders 允许的请求头, 为空则允许预检请求中 Access-Control-Request-Headers 声明的请求头
+	AllowHeaders []string
+
+	// ExposeHeaders 允许客户端读取的响应头
+	ExposeHeaders []string
+
+	// AllowCredentials 是否允许携带 cookie 等凭证, 开启时 Access-Control-Allow-Origin 返回请求来源而非 *
+	AllowCredentials bool
+
+	// MaxAge 预检结果缓存时间, 单位: 秒, 0 则不返回 Access-Control-Max-Age
+	MaxAge int
+}
+
+// defaultCorsPolicy CrossDomain 为 true 且未配置策略时使用, 允许所有来源, 不允许携带凭证
+var defaultCorsPolicy = &CorsPolicy{
+	AllowOrigins: []string{"*"},
+}
+
+// allowOrigin 校验请求来源, 允许携带凭证时只接受明确配置的来源, 不接受 *
+func (p *CorsPolicy) allowOrigin(origin string) bool {
+	for _, o := range p.AllowOrigins {
+		if o == "*" && !p.AllowCredentials || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	if p.AllowOriginReg != nil && p.AllowOriginReg.MatchString(origin) {
+		return true
+	}
+	if p.AllowOriginFunc != nil && p.AllowOriginFunc(origin) {
+		return true
+	}
+	return false
+}
+
+// wildcard 允许所有来源且不携带凭证时返回 *
+func (p *CorsPolicy) wildcard() bool {
+	if p.AllowCredentials {
+		return false
+	}
+	for _, o := range p.AllowOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// handle 处理跨域请求, 预检请求处理完成返回 true
+func (p *CorsPolicy) handle(ctx *Context, origin string, matched *route) bool {
+	header := ctx.Response.Header()
+	preflight := strings.ToUpper(ctx.GetMethod()) == OPTIONS && len(ctx.GetHeader(AccessControlRequestMethod)) > 0
+	if preflight {
+		header.Add(Vary, Origin)
+		header.Add(Vary, AccessControlRequestMethod)
+		header.Add(Vary, AccessControlRequestHeaders)
+	} else if !p.wildcard() {
+		header.Add(Vary, Origin)
+	}
+	if !p.allowOrigin(origin) {
+		if preflight {
+			mLogger.WarnF("跨域请求来源不允许: %v %v", origin, ctx.Request.URL.Path)
+			ctx.Code(StatusForbidden)
+		}
+		return preflight
+	}
+	if p.wildcard() {
+		ctx.SetHeader(AccessControlAllowOrigin, "*")
+	} else {
+		ctx.SetHeader(AccessControlAllowOrigin, origin)
+	}
+	if p.AllowCredentials {
+		ctx.SetHeader(AccessControlAllowCredentials, "true")
+	}
+	if !preflight {
+		if len(p.ExposeHeaders) > 0 {
+			ctx.SetHeader(AccessControlExposeHeaders, strings.Join(p.ExposeHeaders, ", "))
+		}
+		return false
+	}
+	allowMethods := METHODS
+	if len(p.AllowMethods) > 0 {
+		allowMethods = strings.Join(p.AllowMethods, ", ")
+	} else if matched != nil {
+		allowMethods = matched.allow()
+	}
+	ctx.SetHeader(AccessControlAllowMethods, allowMethods)
+	if len(p.AllowHeaders) > 0 {
+		ctx.SetHeader(AccessControlAllowHeaders, strings.Join(p.AllowHeaders, ", "))
+	} else if requestHeaders := ctx.GetHeader(AccessControlRequestHeaders); len(requestHeaders) > 0 {
+		ctx.SetHeader(AccessControlAllowHeaders, requestHeaders)
+	}
+	if p.MaxAge > 0 {
+		ctx.SetHeader(AccessControlMaxAge, strconv.Itoa(p.MaxAge))
+	}
+	ctx.Code(StatusNoContent)
+	return true
+}
+
+// SetCors 设置服务跨域策略, 对未单独设置策略的分组及路由生效, nil 则清除
+func (t *Server) SetCors(policy *CorsPolicy) {
+	t.Lock()
+	defer t.Unlock()
+	t.cors = policy
+}
+
+// RouteCors 设置单个路由的跨域策略, path 需与注册时一致, 需在路由注册之后调用
+func (t *Server) RouteCors(path string, policy *CorsPolicy) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	t.Lock()
+	defer t.Unlock()
+	r := t.router.findRoute(path)
+	if r == nil {
+		mLogger.WarnF("设置跨域策略失败, 路由不存在: %s", path)
+		return
+	}
+	r.cors = policy
+}
+
+// bindRouteGroup 记录路由所属分组
+func (t *Server) bindRouteGroup(path string, g *Group) {
+	t.Lock()
+	defer t.Unlock()
+	if r := t.router.findRoute(path); r != nil {
+		r.group = g
+	}
+}
+
+// corsPolicy 获取路由生效的跨域策略, 未配置且未开启 CrossDomain 时返回 nil
+func (t *Server) corsPolicy(matched *route) *CorsPolicy {
+	t.RLock()
+	defer t.RUnlock()
+	if matched != nil {
+		if matched.cors != nil {
+			return matched.cors
+		}
+		if matched.group != nil {
+			if policy := matched.group.corsPolicy(); policy != nil {
+				return policy
+			}
+		}
+	}
+	if t.cors != nil {
+		return t.cors
+	}
+	if t.CrossDomain {
+		return defaultCorsPolicy
+	}
+	return nil
+}
+
+// Cors 设置分组跨域策略, 对该分组及子分组内的路由生效
+func (g *Group) Cors(policy *CorsPolicy) *Group {
+	g.Lock()
+	defer g.Unlock()
+	g.cors = policy
+	return g
+}
+
+// RouteCors 设置分组内单个路由的跨域策略, path 自动添加分组前缀
+func (g *Group) RouteCors(path string, policy *CorsPolicy) {
+	g.server.RouteCors(g.fullPath(path), policy)
+}
+
+// corsPolicy 本分组或最近的上级分组的跨域策略
+func (g *Group) corsPolicy() *CorsPolicy {
+	g.RLock()
+	policy := g.cors
+	g.RUnlock()
+	if policy == nil && g.parent != nil {
+		return g.parent.corsPolicy()
+	}
+	return policy
+}
+
+// SetCors 设置全局Server跨域策略
+func SetCors(policy *CorsPolicy) {
+	globalServer.SetCors(policy)
+}
+
+// RouteCors 设置全局Server单个路由的跨域策略
+func RouteCors(path string, policy *CorsPolicy) {
+	globalServer.RouteCors(path, policy)
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestCorsPolicy(t *testing.T) {
+	srv := NewServer("", 0)
+	srv.SetCors(&CorsPolicy{
+		AllowOrigins:     []string{"https://a.com"},
+		AllowCredentials: true,
+		ExposeHeaders:    []string{"X-Total"},
+		MaxAge:           600,
+	})
+	api := srv.Group("/api").Cors(&CorsPolicy{
+		AllowOriginReg: regexp.MustCompile(`^https://.*\.b\.com$`),
+	}).Filter(func(c Context) bool {
+		if len(c.GetHeader("token")) <= 0 {
+			c.Code(StatusUnauthorized)
+			return false
+		}
+		return true
+	})
+	api.GET("/user", func(c Context) {
+		c.OK(Plain, []byte("user"))
+	})
+	api.POST("/open", func(c Context) {
+		c.OK(Plain, []byte("open"))
+	})
+	api.RouteCors("/open", &CorsPolicy{AllowOrigins: []string{"*"}})
+	srv.PUT("/item", func(c Context) {
+		c.OK(Plain, []byte("item"))
+	})
+
+	// 预检请求在过滤器之前返回
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(OPTIONS, "/item", nil)
+	req.Header.Set(Origin, "https://a.com")
+	req.Header.Set(AccessControlRequestMethod, PUT)
+	req.Header.Set(AccessControlRequestHeaders, "X-Token")
+	srv.ServeHTTP(w, req)
+	header := w.Header()
+	if w.Code != StatusNoContent || header.Get(AccessControlAllowOrigin) != "https://a.com" ||
+		header.Get(AccessControlAllowCredentials) != "true" || header.Get(AccessControlAllowMethods) != "PUT, OPTIONS" ||
+		header.Get(AccessControlAllowHeaders) != "X-Token" || header.Get(AccessControlMaxAge) != "600" ||
+		len(header.Values(Vary)) != 3 {
+		t.Fatalf("preflight error: %v %v", w.Code, header)
+	}
+
+	// 来源不允许
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(OPTIONS, "/item", nil)
+	req.Header.Set(Origin, "https://c.com")
+	req.Header.Set(AccessControlRequestMethod, PUT)
+	srv.ServeHTTP(w, req)
+	if w.Code != StatusForbidden || len(w.Header().Get(AccessControlAllowOrigin)) > 0 {
+		t.Fatalf("preflight origin error: %v %v", w.Code, w.Header())
+	}
+
+	// 实际请求
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(PUT, "/item", nil)
+	req.Header.Set(Origin, "https://a.com")
+	srv.ServeHTTP(w, req)
+	if w.Body.String() != "item" || w.Header().Get(AccessControlExposeHeaders) != "X-Total" || w.Header().Get(Vary) != Origin {
+		t.Fatalf("cors request error: %v", w.Header())
+	}
+
+	// 分组策略
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(OPTIONS, "/api/user", nil)
+	req.Header.Set(Origin, "https://x.b.com")
+	req.Header.Set(AccessControlRequestMethod, GET)
+	srv.ServeHTTP(w, req)
+	if w.Code != StatusNoContent || w.Header().Get(AccessControlAllowOrigin) != "https://x.b.com" {
+		t.Fatalf("group cors error: %v %v", w.Code, w.Header())
+	}
+
+	// 路由策略
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(POST, "/api/open", nil)
+	req.Header.Set(Origin, "https://c.com")
+	req.Header.Set("token", "1")
+	srv.ServeHTTP(w, req)
+	if w.Body.String() != "open" || w.Header().Get(AccessControlAllowOrigin) != "*" {
+		t.Fatalf("route cors error: %v", w.Header())
+	}
+
+	// 普通 OPTIONS 请求按路由处理
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(OPTIONS, "/api/user", nil)
+	req.Header.Set(Origin, "https://x.b.com")
+	srv.ServeHTTP(w, req)
+	if w.Code != StatusNoContent || w.Header().Get(Allow) != "GET, HEAD, OPTIONS" || len(w.Header().Get(AccessControlAllowMethods)) > 0 {
+		t.Fatalf("plain options error: %v %v", w.Code, w.Header())
+	}
+
+	// 允许携带凭证时 * 不生效, 不回显其他来源
+	srv.RouteCors("/item", &CorsPolicy{AllowOrigins: []string{"*", "https://a.com"}, AllowCredentials: true})
+	for origin, allowed := range map[string]string{"https://evil.com": "", "https://a.com": "https://a.com"} {
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest(PUT, "/item", nil)
+		req.Header.Set(Origin, origin)
+		srv.ServeHTTP(w, req)
+		if w.Header().Get(AccessControlAllowOrigin) != allowed ||
+			(len(allowed) <= 0) != (len(w.Header().Get(AccessControlAllowCredentials)) <= 0) {
+			t.Fatalf("credentials origin %v error: %v", origin, w.Header())
+		}
+	}
+}
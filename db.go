@@ -77,7 +77,14 @@ func (d Database) Ping() error {
 //
 // ? 代表参数
 func (d Database) Query(sql string, params ...interface{}) ([]map[string]string, error) {
-	timeoutContext, cancel := context.WithTimeout(context.Background(), d.timeoutSeconds)
+	return d.QueryContext(context.Background(), sql, params...)
+}
+
+// QueryContext 执行数据库查询, ctx 取消或超时后中断查询, 超时时间不超过连接池的超时时间
+//
+// 处理http请求时使用 Context.Ctx() 作为 ctx
+func (d Database) QueryContext(ctx context.Context, sql string, params ...interface{}) ([]map[string]string, error) {
+	timeoutContext, cancel := d.timeoutContext(ctx)
 	defer cancel()
 	rows, err := d.conn.QueryContext(timeoutContext, sql, params...)
 	if err != nil {
@@ -90,7 +97,14 @@ func (d Database) Query(sql string, params ...interface{}) ([]map[string]string,
 //
 // ? 代表参数
 func (d Database) Exec(sql string, params ...interface{}) (int64, int64, error) {
-	timeoutContext, cancel := context.WithTimeout(context.Background(), d.timeoutSeconds)
+	return d.ExecContext(context.Background(), sql, params...)
+}
+
+// ExecContext 执行数据库写入更改删除, ctx 取消或超时后中断执行, 超时时间不超过连接池的超时时间
+//
+// 处理http请求时使用 Context.Ctx() 作为 ctx
+func (d Database) ExecContext(ctx context.Context, sql string, params ...interface{}) (int64, int64, error) {
+	timeoutContext, cancel := d.timeoutContext(ctx)
 	defer cancel()
 	rows, err := d.conn.ExecContext(timeoutContext, sql, params...)
 	if err != nil {
@@ -101,6 +115,14 @@ func (d Database) Exec(sql string, params ...interface{}) (int64, int64, error)
 	return rowsAffected, lastInsertedId, nil
 }
 
+// timeoutContext 在 ctx 基础上添加连接池的超时时间
+func (d Database) timeoutContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.timeoutSeconds <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d.timeoutSeconds)
+}
+
 // DatabaseSchema 库结构
 type DatabaseSchema struct {
 	Name   string                 `json:"name"`
@@ -122,7 +144,12 @@ type ColumnSchema struct {
 
 // Schema 获取数据库结构
 func (d Database) Schema() (DatabaseSchema, error) {
-	res, err := d.Query("select table_name, column_name, data_type, column_comment from information_schema.columns where table_schema = ? order by table_name", d.dbName)
+	return d.SchemaContext(context.Background())
+}
+
+// SchemaContext 获取数据库结构, ctx 取消或超时后中断查询
+func (d Database) SchemaContext(ctx context.Context) (DatabaseSchema, error) {
+	res, err := d.QueryContext(ctx, "select table_name, column_name, data_type, column_comment from information_schema.columns where table_schema = ? order by table_name", d.dbName)
 	if err != nil {
 		return DatabaseSchema{}, err
 	}
@@ -186,6 +213,13 @@ func SqlParamIsTp(p string) bool {
 //
 // 返回Swagger对象
 func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
+	return MountDbHandler(globalServer, d, prefix)
+}
+
+// MountDbHandler 在指定 Server 或 Group 上注册数据库处理接口
+//
+// 返回Swagger对象, 路径包含分组前缀
+func MountDbHandler(router Router, d *Database, prefix string) []*SwaggerPath {
 
 	dbHandlerLogger := GetLogger(fmt.Sprintf("db-%s", d.dbName))
 
@@ -193,9 +227,9 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 		prefix = fmt.Sprintf("/%s", prefix)
 	}
 
-	schemaSwagger := SwaggerBuildPath(fmt.Sprintf("%s/schema", prefix), d.dbName, "get", "db schema")
-	RegisterHandler(fmt.Sprintf("%s/schema", prefix), func(c Context) {
-		res, err := d.Schema()
+	schemaSwagger := SwaggerBuildPath(fmt.Sprintf("%s%s/schema", router.Prefix(), prefix), d.dbName, "get", "db schema")
+	router.RegisterHandler(fmt.Sprintf("%s/schema", prefix), func(c Context) {
+		res, err := d.SchemaContext(c.Ctx())
 		if err != nil {
 			c.ApiResponse(-1, err.Error(), nil)
 			return
@@ -204,13 +238,13 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 		return
 	})
 
-	statusSwagger := SwaggerBuildPath(fmt.Sprintf("%s/status", prefix), d.dbName, "get", "db status")
-	RegisterHandler(fmt.Sprintf("%s/status", prefix), func(c Context) {
+	statusSwagger := SwaggerBuildPath(fmt.Sprintf("%s%s/status", router.Prefix(), prefix), d.dbName, "get", "db status")
+	router.RegisterHandler(fmt.Sprintf("%s/status", prefix), func(c Context) {
 		c.ApiResponse(0, "", d.Status())
 		return
 	})
 
-	selectSwagger := SwaggerBuildPath(fmt.Sprintf("%s/select/{table}", prefix), d.dbName, "get", "select from table")
+	selectSwagger := SwaggerBuildPath(fmt.Sprintf("%s%s/select/{table}", router.Prefix(), prefix), d.dbName, "get", "select from table")
 	selectSwagger.AddParameter(SwaggerParameter{
 		Name:        "table",
 		Description: "table name",
@@ -229,7 +263,7 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 		In:          "query",
 		Required:    false,
 	})
-	RegisterHandler(fmt.Sprintf("%s/select/{table}", prefix), func(c Context) {
+	router.RegisterHandler(fmt.Sprintf("%s/select/{table}", prefix), func(c Context) {
 		table := c.GetPathParam("table")
 		if !SqlParamCheck(table) {
 			c.ApiResponse(-1, "", nil)
@@ -256,7 +290,7 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 		}
 		selectSql := strings.TrimSpace(fmt.Sprintf("select * from %s %s %s", table, orderBySql, limitSql))
 		dbHandlerLogger.InfoF("sql: %s", selectSql)
-		res, err := d.Query(selectSql)
+		res, err := d.QueryContext(c.Ctx(), selectSql)
 		if err != nil {
 			c.ApiResponse(-1, err.Error(), nil)
 			return
@@ -265,7 +299,7 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 		return
 	})
 
-	insertSwagger := SwaggerBuildPath(fmt.Sprintf("%s/insert/{table}", prefix), d.dbName, "post", "insert into table")
+	insertSwagger := SwaggerBuildPath(fmt.Sprintf("%s%s/insert/{table}", router.Prefix(), prefix), d.dbName, "post", "insert into table")
 	insertSwagger.AddParameter(SwaggerParameter{
 		Name:        "table",
 		Description: "table name",
@@ -279,7 +313,7 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 		In:          "body",
 		Required:    true,
 	})
-	RegisterHandler(fmt.Sprintf("%s/insert/{table}", prefix), func(c Context) {
+	router.RegisterHandler(fmt.Sprintf("%s/insert/{table}", prefix), func(c Context) {
 		table := c.GetPathParam("table")
 		if !SqlParamCheck(table) {
 			c.ApiResponse(-1, "", nil)
@@ -323,7 +357,7 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 
 		dbHandlerLogger.InfoF("sql: %s, params: %v", insertSql, sqlParams)
 
-		if _, LastModified, err := d.Exec(insertSql, sqlParams...); err == nil {
+		if _, LastModified, err := d.ExecContext(c.Ctx(), insertSql, sqlParams...); err == nil {
 			c.ApiResponse(0, "", map[string]interface{}{
 				"id": LastModified,
 			})
@@ -334,7 +368,7 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 		}
 	})
 
-	updateSwagger := SwaggerBuildPath(fmt.Sprintf("%s/update/{table}", prefix), d.dbName, "post", "update table")
+	updateSwagger := SwaggerBuildPath(fmt.Sprintf("%s%s/update/{table}", router.Prefix(), prefix), d.dbName, "post", "update table")
 	updateSwagger.AddParameter(SwaggerParameter{
 		Name:        "table",
 		Description: "table name",
@@ -350,7 +384,7 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 		In:          "body",
 		Required:    true,
 	})
-	RegisterHandler(fmt.Sprintf("%s/update/{table}", prefix), func(c Context) {
+	router.RegisterHandler(fmt.Sprintf("%s/update/{table}", prefix), func(c Context) {
 		table := c.GetPathParam("table")
 		if !SqlParamCheck(table) {
 			c.ApiResponse(-1, "", nil)
@@ -397,7 +431,7 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 		return
 	})
 
-	deleteSwagger := SwaggerBuildPath(fmt.Sprintf("%s/delete/{table}", prefix), d.dbName, "post", "delete from table")
+	deleteSwagger := SwaggerBuildPath(fmt.Sprintf("%s%s/delete/{table}", router.Prefix(), prefix), d.dbName, "post", "delete from table")
 	deleteSwagger.AddParameter(SwaggerParameter{
 		Name:        "table",
 		Description: "table name",
@@ -413,7 +447,7 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 		In:          "body",
 		Required:    true,
 	})
-	RegisterHandler(fmt.Sprintf("%s/delete/{table}", prefix), func(c Context) {
+	router.RegisterHandler(fmt.Sprintf("%s/delete/{table}", prefix), func(c Context) {
 		table := c.GetPathParam("table")
 		if !SqlParamCheck(table) {
 			c.ApiResponse(-1, "", nil)
@@ -435,7 +469,7 @@ func RegisterDbHandler(d *Database, prefix string) []*SwaggerPath {
 		}
 		deleteSql := fmt.Sprintf("delete from %s where id = ?", table)
 		dbHandlerLogger.InfoF("sql: %s, params: %v", deleteSql, id)
-		if _, _, err := d.Exec(deleteSql, id); err == nil {
+		if _, _, err := d.ExecContext(c.Ctx(), deleteSql, id); err == nil {
 			c.ApiResponse(0, "", nil)
 			return
 		} else {
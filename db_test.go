@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blockingDriver 查询阻塞直至 ctx 取消, 用于验证取消传递
+type blockingDriver struct{}
+
+type blockingConn struct{}
+
+type blockingRows struct{}
+
+func (blockingDriver) Open(string) (driver.Conn, error) {
+	return blockingConn{}, nil
+}
+
+func (blockingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (blockingConn) Close() error {
+	return nil
+}
+
+func (blockingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (blockingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if query == "select 1" {
+		return blockingRows{}, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingRows) Columns() []string {
+	return []string{"v"}
+}
+
+func (blockingRows) Close() error {
+	return nil
+}
+
+func (blockingRows) Next([]driver.Value) error {
+	return io.EOF
+}
+
+func init() {
+	sql.Register("blocking", blockingDriver{})
+}
+
+func TestDatabaseContext(t *testing.T) {
+	conn, _ := sql.Open("blocking", "")
+	db := Database{conn: conn, timeoutSeconds: time.Minute}
+	defer db.Close()
+	if _, err := db.Query("select 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := db.QueryContext(ctx, "select sleep(60)"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("query not canceled: %v", err)
+	}
+
+	srv := NewServer("", 0)
+	srv.POST("/exec", func(c Context) {
+		_, _, err := db.ExecContext(c.Ctx(), "update t set v = sleep(60)")
+		c.OK(Plain, []byte(err.Error()))
+	}, Timeout(20*time.Millisecond))
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(POST, "/exec", nil))
+	if w.Body.String() != context.DeadlineExceeded.Error() {
+		t.Fatalf("exec not canceled: %v", w.Body.String())
+	}
+}
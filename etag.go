@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+ETagConfig 自动 ETag 配置
+
+Weak : 生成弱校验 ETag(W/"..."), 内容语义相同即可复用缓存时使用
+
+MaxSize : 生成 ETag 的最大响应字节数, 超出后不生成 ETag, 0 使用默认值 1MB
+*/
+type ETagConfig struct {
+	Weak    bool
+	MaxSize int
+}
+
+// DefaultETagConfig 默认 ETag 配置, 生成强校验 ETag
+var DefaultETagConfig = ETagConfig{}
+
+/*
+ETag 为 GET, HEAD 请求的 200 响应按响应体生成 ETag, 请求 If-None-Match 匹配时返回 304
+
+处理器已设置 ETag 时不再生成, 只判断条件请求; 响应 Cache-Control 包含 no-store 时不生成
+
+通过 BufferResponse 缓存响应, 处理结束后写出, 期间 Flush 不生效; SSE 请求(Accept: text/event-stream)不缓存;
+可作为路由中间件按路由启用
+
+	srv.GET("/api/list", list, ETag(DefaultETagConfig))
+*/
+func ETag(conf ETagConfig) Middleware {
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = 1 << 20
+	}
+	return func(ctx *Context, next func()) {
+		if ctx.GetMethod() != GET && ctx.GetMethod() != HEAD ||
+			strings.Contains(ctx.GetHeader("Accept"), EventStream) || !ctx.BufferResponse() {
+			next()
+			return
+		}
+		next()
+		if !ctx.Written() || ctx.Status() != StatusOK {
+			return
+		}
+		header := ctx.Response.Header()
+		if hasCacheDirective(header.Get("Cache-Control"), "no-store") {
+			return
+		}
+		if len(header.Get("Etag")) <= 0 {
+			body := ctx.BufferedBody()
+			if body == nil || len(body) > conf.MaxSize {
+				return
+			}
+			header.Set("Etag", hashETag(body, conf.Weak))
+		}
+		modtime, _ := http.ParseTime(header.Get("Last-Modified"))
+		status := evalPreconditions(*ctx, modtime)
+		if status == 0 || !ctx.ResetResponse() {
+			return
+		}
+		if status == StatusNotModified {
+			_ = ctx.WriteNotModified()
+		} else {
+			ctx.Code(status)
+		}
+	}
+}
+
+/*
+CheckNotModified 设置 ETag 及 Last-Modified 响应头并判断条件请求,
+返回 true 时已写入 304 或 412, 处理器可直接返回, 无需查询数据及生成响应
+
+etag : 资源版本, 未加引号时自动添加, 为空不设置; modtime : 资源修改时间, 零值不设置
+
+	if c.CheckNotModified(fmt.Sprintf("%d", article.Version), article.UpdateTime) {
+		return
+	}
+*/
+func (c *Context) CheckNotModified(etag string, modtime time.Time) bool {
+	if len(etag) > 0 {
+		if !strings.HasPrefix(etag, `"`) && !strings.HasPrefix(etag, `W/"`) {
+			etag = fmt.Sprintf(`"%s"`, etag)
+		}
+		c.SetHeader("Etag", etag)
+	}
+	if !isZeroTime(modtime) {
+		c.SetHeader("Last-Modified", modtime.UTC().Format(HttpTimeFormattor))
+	}
+	switch evalPreconditions(*c, modtime) {
+	case StatusNotModified:
+		_ = c.WriteNotModified()
+		return true
+	case StatusPreconditionFailed:
+		c.Code(StatusPreconditionFailed)
+		return true
+	}
+	return false
+}
+
+// hashETag 按内容哈希生成 ETag
+func hashETag(data []byte, weak bool) string {
+	sum := sha256.Sum256(data)
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:])[:32])
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// hasCacheDirective Cache-Control 是否包含指令
+func hasCacheDirective(cacheControl string, directive string) bool {
+	for _, item := range strings.Split(cacheControl, ",") {
+		item = strings.TrimSpace(item)
+		if index := strings.Index(item, "="); index >= 0 {
+			item = item[:index]
+		}
+		if strings.EqualFold(item, directive) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETagMiddleware(t *testing.T) {
+	srv := NewServer("", 0)
+	srv.Route(GET, "/data", func(c *Context) {
+		c.WriteJSON(map[string]string{"name": "middleware"})
+	}, ETag(DefaultETagConfig))
+	srv.Route(GET, "/weak", func(c *Context) {
+		c.OK(Plain, []byte("weak"))
+	}, ETag(ETagConfig{Weak: true}))
+	srv.Route(GET, "/private", func(c *Context) {
+		c.SetHeader("Cache-Control", "no-store")
+		c.OK(Plain, []byte("private"))
+	}, ETag(DefaultETagConfig))
+	srv.Route(GET, "/large", func(c *Context) {
+		c.OK(Plain, []byte(strings.Repeat("0", 64)))
+	}, ETag(ETagConfig{MaxSize: 16}))
+	srv.Route(GET, "/plain", func(c *Context) {
+		c.OK(Plain, []byte("plain"))
+	})
+	srv.Route(GET, "/late", func(c *Context) {
+		time.Sleep(20 * time.Millisecond)
+		c.OK(Plain, []byte("ok"))
+	}, ETag(DefaultETagConfig), Timeout(10*time.Millisecond))
+
+	request := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(GET, path, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("/data", nil)
+	etag := w.Header().Get("Etag")
+	if w.Code != StatusOK || !strings.HasPrefix(etag, `"`) || w.Body.String() != `{"name":"middleware"}` {
+		t.Fatalf("etag response error: %v %v %q", w.Code, w.Header(), w.Body.String())
+	}
+	w = request("/data", map[string]string{"If-None-Match": etag})
+	if w.Code != StatusNotModified || w.Body.Len() > 0 || len(w.Header().Get(ContentType)) > 0 {
+		t.Fatalf("if-none-match should return 304: %v %v", w.Code, w.Header())
+	}
+	// no-cache 要求向服务端验证, 仍按 If-None-Match 返回 304
+	w = request("/data", map[string]string{"If-None-Match": etag, "Cache-Control": "no-cache"})
+	if w.Code != StatusNotModified || w.Header().Get("Etag") != etag {
+		t.Fatalf("no-cache request should be revalidated: %v", w.Code)
+	}
+	w = request("/data", map[string]string{"If-None-Match": `"other"`})
+	if w.Code != StatusOK {
+		t.Fatalf("etag mismatch should return 200: %v", w.Code)
+	}
+
+	w = request("/weak", nil)
+	if !strings.HasPrefix(w.Header().Get("Etag"), `W/"`) {
+		t.Fatalf("weak etag error: %v", w.Header())
+	}
+	w = request("/weak", map[string]string{"If-None-Match": strings.TrimPrefix(w.Header().Get("Etag"), "W/")})
+	if w.Code != StatusNotModified {
+		t.Fatalf("weak etag should match: %v", w.Code)
+	}
+	for _, path := range []string{"/private", "/large", "/plain"} {
+		w = request(path, map[string]string{"If-None-Match": "*"})
+		if w.Code != StatusOK || len(w.Header().Get("Etag")) > 0 {
+			t.Fatalf("%v should not have etag: %v %v", path, w.Code, w.Header())
+		}
+	}
+	if w := request("/large", nil); w.Body.Len() != 64 {
+		t.Fatalf("large response error: %v", w.Body.Len())
+	}
+
+	// 超时前已写入缓存的响应不再追加 503
+	w = request("/late", nil)
+	if w.Code != StatusOK || w.Body.String() != "ok" || len(w.Header().Get("Etag")) <= 0 {
+		t.Fatalf("timeout after write error: %v %q", w.Code, w.Body.String())
+	}
+}
+
+func TestCheckNotModified(t *testing.T) {
+	srv := NewServer("", 0)
+	srv.Use(Compress(CompressConfig{MinLength: 1}))
+	modtime := time.Date(2022, 6, 1, 8, 0, 0, 0, time.UTC)
+	loads := 0
+	srv.Route(GET, "/article", func(c *Context) {
+		if c.CheckNotModified("v3", modtime) {
+			return
+		}
+		loads++
+		c.OK(Plain, []byte("article"))
+	}, ETag(DefaultETagConfig))
+	srv.Route(PUT, "/article", func(c *Context) {
+		if c.CheckNotModified("v3", time.Time{}) {
+			return
+		}
+		c.OK(Plain, []byte("updated"))
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(GET, "/article", nil)
+	r.Header.Set(AcceptEncoding, EncodingGzip)
+	srv.ServeHTTP(w, r)
+	if w.Code != StatusOK || w.Header().Get("Etag") != `W/"v3"` || w.Header().Get(ContentEncoding) != EncodingGzip || loads != 1 {
+		t.Fatalf("declared etag error: %v %v %v", w.Code, w.Header(), loads)
+	}
+
+	for header, value := range map[string]string{"If-None-Match": `W/"v3"`, "If-Modified-Since": modtime.Format(HttpTimeFormattor)} {
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(GET, "/article", nil)
+		r.Header.Set(header, value)
+		srv.ServeHTTP(w, r)
+		if w.Code != StatusNotModified || loads != 1 {
+			t.Fatalf("%v should skip handler: %v %v", header, w.Code, loads)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(PUT, "/article", nil)
+	r.Header.Set("If-Match", `"v2"`)
+	srv.ServeHTTP(w, r)
+	if w.Code != StatusPreconditionFailed {
+		t.Fatalf("if-match mismatch should return 412: %v", w.Code)
+	}
+}
@@ -1,15 +1,20 @@
 package middleware
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -33,7 +38,7 @@ func serveContent(context Context, name string, modtime time.Time, size int64, c
 
 	// If Content-Type isn't set, use the file's extension to find it, but
 	// if the Content-Type is unset explicitly, do not sniff the type.
-	ctypes, haveType := context.Request.Header["Content-Type"]
+	ctypes, haveType := context.Response.Header()["Content-Type"]
 	var ctype string
 	if !haveType {
 		ctype = mime.TypeByExtension(filepath.Ext(name))
@@ -130,7 +135,7 @@ func serveContent(context Context, name string, modtime time.Time, size int64, c
 		}
 
 		context.SetHeader("Accept-Ranges", "bytes")
-		if context.GetHeader("Content-Encoding") == "" {
+		if context.Response.Header().Get("Content-Encoding") == "" {
 			context.SetHeader("Content-Length", strconv.FormatInt(sendSize, 10))
 		}
 	}
@@ -142,10 +147,82 @@ func serveContent(context Context, name string, modtime time.Time, size int64, c
 	}
 }
 
-func FileProcessor(context Context) {
+// FileServerConfig 静态文件服务配置
+type FileServerConfig struct {
+	// Root 静态文件根目录, 为空则使用工作目录, 请求路径无法访问根目录之外的文件, 包括指向根目录之外的符号链接
+	Root string
 
-	fileName := context.Request.RequestURI[1:]
-	f, err := os.Open(fileName)
+	// Prefix 路由前缀, 查找文件前从请求路径中去除
+	Prefix string
+
+	// Index 请求目录时依次查找的首页文件, 默认 index.html
+	Index []string
+
+	// Browse 目录下不存在首页文件时返回目录列表, 支持 sort=name|size|time 及 order=asc|desc 参数,
+	// Accept 为 application/json 或 format=json 时返回json
+	Browse bool
+
+	// ShowHidden 目录列表中显示 . 开头的文件
+	ShowHidden bool
+}
+
+// FileEntry 目录列表项
+type FileEntry struct {
+	Name    string    `json:"name"`
+	Url     string    `json:"url"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	IsDir   bool      `json:"isDir"`
+}
+
+// FileServer 返回静态文件处理器, 支持 Range, 条件请求, 目录首页及目录列表
+func FileServer(conf FileServerConfig) func(Context) {
+	if len(conf.Root) <= 0 {
+		conf.Root = "."
+	}
+	if len(conf.Index) <= 0 {
+		conf.Index = []string{"index.html"}
+	}
+	conf.Prefix = strings.TrimSuffix(conf.Prefix, "/")
+	return conf.serve
+}
+
+// RegisterFileServer 注册静态文件目录, prefix 下的请求映射至 conf.Root
+func (t *Server) RegisterFileServer(prefix string, conf FileServerConfig) {
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = fmt.Sprintf("/%s", prefix)
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = fmt.Sprintf("%s/", prefix)
+	}
+	conf.Prefix = prefix
+	t.RegisterHandler(prefix, FileServer(conf))
+}
+
+// RegisterFileServer 在全局Server注册静态文件目录
+func RegisterFileServer(prefix string, conf FileServerConfig) {
+	globalServer.RegisterFileServer(prefix, conf)
+}
+
+// FileProcessor 以工作目录为根目录返回请求路径对应的文件
+var FileProcessor = FileServer(FileServerConfig{})
+
+func (conf FileServerConfig) serve(context Context) {
+	urlPath := context.Request.URL.Path
+	if len(conf.Prefix) > 0 {
+		if !strings.HasPrefix(urlPath, conf.Prefix) {
+			context.Error(StatusNotFound, StatusNotFoundView)
+			return
+		}
+		urlPath = urlPath[len(conf.Prefix):]
+	}
+	name, err := resolveFile(conf.Root, urlPath)
+	if ProcessError(err) {
+		msg, code := toHTTPError(err)
+		context.Error(code, msg)
+		return
+	}
+	f, err := os.Open(name)
 	if ProcessError(err) {
 		msg, code := toHTTPError(err)
 		context.Error(code, msg)
@@ -158,21 +235,168 @@ func FileProcessor(context Context) {
 		context.Error(code, msg)
 		return
 	}
-	// Still a directory? (we didn't find an index.html file)
-	if d.IsDir() { // golang原处理逻辑为目录列表
-		// if checkIfModifiedSince(context, d.ModTime()) == condFalse {
-		// 	writeNotModified(context)
-		// 	return
-		// }
-		// context.SetHeader("Last-Modified", d.ModTime().UTC().Format(HttpTimeFormattor))
-		// dirList(w, r, f)
-
+	if !d.IsDir() {
+		// serveContent will check modification time
+		serveContent(context, d.Name(), d.ModTime(), d.Size(), f)
+		return
+	}
+	// 目录需以 / 结尾, 保证页面中的相对路径正确
+	if !strings.HasSuffix(context.Request.URL.Path, "/") {
+		localRedirect(context, path.Base(context.Request.URL.Path)+"/")
+		return
+	}
+	for _, index := range conf.Index {
+		indexName, err := resolveFile(conf.Root, path.Join(urlPath, index))
+		if err != nil {
+			continue
+		}
+		ff, err := os.Open(indexName)
+		if err != nil {
+			continue
+		}
+		dd, err := ff.Stat()
+		if err != nil || dd.IsDir() {
+			ff.Close()
+			continue
+		}
+		defer ff.Close()
+		serveContent(context, dd.Name(), dd.ModTime(), dd.Size(), ff)
+		return
+	}
+	if !conf.Browse {
 		context.Error(StatusNotFound, StatusNotFoundView)
 		return
 	}
+	if checkIfModifiedSince(context, d.ModTime()) == condFalse {
+		writeNotModified(context)
+		return
+	}
+	setLastModified(context, d.ModTime())
+	conf.dirList(context, f)
+}
+
+// resolveFile 将请求路径转换为根目录下的文件路径
+//
+// 路径中的 .. 无法越过根目录, 解析符号链接后位于根目录之外的文件视为不存在
+func resolveFile(root string, urlPath string) (string, error) {
+	if strings.ContainsRune(urlPath, 0) ||
+		(filepath.Separator != '/' && strings.ContainsRune(urlPath, filepath.Separator)) {
+		return "", os.ErrNotExist
+	}
+	name := filepath.Join(root, filepath.FromSlash(path.Clean("/"+urlPath)))
+	realName, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return "", err
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	realName, _ = filepath.Abs(realName)
+	realRoot, _ = filepath.Abs(realRoot)
+	rel, err := filepath.Rel(realRoot, realName)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		mLogger.WarnF("拒绝访问根目录之外的文件: %s", urlPath)
+		return "", os.ErrNotExist
+	}
+	return realName, nil
+}
 
-	// serveContent will check modification time
-	serveContent(context, d.Name(), d.ModTime(), d.Size(), f)
+// localRedirect 重定向至相对路径, 保留query参数
+func localRedirect(context Context, newPath string) {
+	if q := context.Request.URL.RawQuery; q != "" {
+		newPath += "?" + q
+	}
+	context.SetHeader("Location", newPath)
+	context.Code(StatusMovedPermanently)
+}
+
+var dirListTemplate = template.Must(template.New("dirList").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Path}}</title>
+</head>
+<body>
+<h1>{{.Path}}</h1>
+<table>
+<tr><th><a href="?sort=name&order={{.NameOrder}}">Name</a></th><th><a href="?sort=size&order={{.SizeOrder}}">Size</a></th><th><a href="?sort=time&order={{.TimeOrder}}">Modified</a></th></tr>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.Url}}">{{.Name}}</a></td><td>{{if not .IsDir}}{{.Size}}{{end}}</td><td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// dirList 返回目录列表, 目录排在文件之前
+func (conf FileServerConfig) dirList(context Context, f *os.File) {
+	infos, err := f.Readdir(-1)
+	if ProcessError(err) {
+		context.Error(StatusInternalServerError, "Error reading directory")
+		return
+	}
+	entries := make([]FileEntry, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		if !conf.ShowHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		if info.IsDir() {
+			name += "/"
+		}
+		entries = append(entries, FileEntry{
+			Name:    name,
+			Url:     (&url.URL{Path: name}).String(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+		})
+	}
+	sortKey := context.GetQueryParam("sort")
+	desc := context.GetQueryParam("order") == "desc"
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		switch sortKey {
+		case "size":
+			if a.Size != b.Size {
+				return (a.Size < b.Size) != desc
+			}
+		case "time":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime) != desc
+			}
+		}
+		if a.Name == b.Name {
+			return false
+		}
+		return (a.Name < b.Name) != desc
+	})
+	if context.GetQueryParam("format") == "json" || strings.Contains(context.GetHeader("Accept"), "application/json") {
+		context.WriteJSON(entries)
+		return
+	}
+	order := func(key string) string {
+		if (sortKey == key || (len(sortKey) <= 0 && key == "name")) && !desc {
+			return "desc"
+		}
+		return "asc"
+	}
+	buf := &bytes.Buffer{}
+	err = dirListTemplate.Execute(buf, map[string]interface{}{
+		"Path":      context.Request.URL.Path,
+		"Entries":   entries,
+		"NameOrder": order("name"),
+		"SizeOrder": order("size"),
+		"TimeOrder": order("time"),
+	})
+	if ProcessError(err) {
+		context.Error(StatusInternalServerError, "Error rendering directory")
+		return
+	}
+	context.OK(Html, buf.Bytes())
 }
 
 // toHTTPError returns a non-specific HTTP error message and status code
@@ -204,36 +428,45 @@ const (
 // checkPreconditions evaluates request preconditions and reports whether a precondition
 // resulted in sending StatusNotModified or StatusPreconditionFailed.
 func checkPreconditions(context Context, modtime time.Time) (done bool, rangeHeader string) {
+	switch evalPreconditions(context, modtime) {
+	case StatusPreconditionFailed:
+		context.Code(StatusPreconditionFailed)
+		return true, ""
+	case StatusNotModified:
+		writeNotModified(context)
+		return true, ""
+	}
+
+	rangeHeader = context.GetHeader("Range")
+	if rangeHeader != "" && checkIfRange(context, modtime) == condFalse {
+		rangeHeader = ""
+	}
+	return false, rangeHeader
+}
+
+// evalPreconditions 按 RFC 7232 第6节判断条件请求, 返回 StatusNotModified, StatusPreconditionFailed,
+// 条件均满足时返回0; ETag 从响应头读取
+func evalPreconditions(context Context, modtime time.Time) int {
 	// This function carefully follows RFC 7232 section 6.
 	ch := checkIfMatch(context)
 	if ch == condNone {
 		ch = checkIfUnmodifiedSince(context, modtime)
 	}
 	if ch == condFalse {
-		context.Code(StatusPreconditionFailed)
-		return true, ""
+		return StatusPreconditionFailed
 	}
 	switch checkIfNoneMatch(context) {
 	case condFalse:
 		if context.GetMethod() == "GET" || context.GetMethod() == "HEAD" {
-			writeNotModified(context)
-			return true, ""
-		} else {
-			context.Code(StatusPreconditionFailed)
-			return true, ""
+			return StatusNotModified
 		}
+		return StatusPreconditionFailed
 	case condNone:
 		if checkIfModifiedSince(context, modtime) == condFalse {
-			writeNotModified(context)
-			return true, ""
+			return StatusNotModified
 		}
 	}
-
-	rangeHeader = context.GetHeader("Range")
-	if rangeHeader != "" && checkIfRange(context, modtime) == condFalse {
-		rangeHeader = ""
-	}
-	return false, rangeHeader
+	return 0
 }
 
 func checkIfMatch(context Context) condResult {
@@ -257,7 +490,7 @@ func checkIfMatch(context Context) condResult {
 		if etag == "" {
 			break
 		}
-		if etagStrongMatch(etag, context.GetHeader("Etag")) {
+		if etagStrongMatch(etag, context.Response.Header().Get("Etag")) {
 			return condTrue
 		}
 		im = remain
@@ -335,6 +568,7 @@ func checkIfNoneMatch(context Context) condResult {
 		}
 		if buf[0] == ',' {
 			buf = buf[1:]
+			continue
 		}
 		if buf[0] == '*' {
 			return condFalse
@@ -343,7 +577,7 @@ func checkIfNoneMatch(context Context) condResult {
 		if etag == "" {
 			break
 		}
-		if etagWeakMatch(etag, context.GetHeader("Etag")) {
+		if etagWeakMatch(etag, context.Response.Header().Get("Etag")) {
 			return condFalse
 		}
 		buf = remain
@@ -381,7 +615,7 @@ func checkIfRange(context Context, modtime time.Time) condResult {
 	}
 	etag, _ := scanETag(ir)
 	if etag != "" {
-		if etagStrongMatch(etag, context.GetHeader("Etag")) {
+		if etagStrongMatch(etag, context.Response.Header().Get("Etag")) {
 			return condTrue
 		} else {
 			return condFalse
@@ -423,7 +657,7 @@ func writeNotModified(context Context) {
 	// response does not have an ETag field).
 	context.DelHeader("Content-Type")
 	context.DelHeader("Content-Length")
-	if context.GetHeader("Etag") != "" {
+	if context.Response.Header().Get("Etag") != "" {
 		context.DelHeader("Last-Modified")
 	}
 	context.Code(StatusNotModified)
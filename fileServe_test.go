@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fileServerFixture(t *testing.T) (string, *Server) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	_ = ioutil.WriteFile(filepath.Join(root, "data.txt"), []byte("0123456789abcdef"), 0644)
+	_ = os.MkdirAll(filepath.Join(root, "site", "sub"), 0755)
+	_ = ioutil.WriteFile(filepath.Join(root, "site", "index.html"), []byte("<h1>index</h1>"), 0644)
+	_ = os.MkdirAll(filepath.Join(root, "files", "dir"), 0755)
+	_ = ioutil.WriteFile(filepath.Join(root, "files", "small.txt"), []byte("1"), 0644)
+	_ = ioutil.WriteFile(filepath.Join(root, "files", "big.txt"), []byte("1234567890"), 0644)
+	_ = ioutil.WriteFile(filepath.Join(root, "files", ".hidden"), []byte("secret"), 0644)
+	_ = ioutil.WriteFile(filepath.Join(outside, "passwd"), []byte("root"), 0644)
+	if err := os.Symlink(filepath.Join(outside, "passwd"), filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer("", 0)
+	srv.RegisterFileServer("/static", FileServerConfig{Root: root, Browse: true})
+	return root, srv
+}
+
+func serveFileRequest(srv *Server, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(GET, "/", nil)
+	req.URL.Path = target
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	return w
+}
+
+func TestFileServerRange(t *testing.T) {
+	root, srv := fileServerFixture(t)
+	w := serveFileRequest(srv, "/static/data.txt", map[string]string{"Range": "bytes=2-5"})
+	if w.Code != StatusPartialContent || w.Body.String() != "2345" || w.Header().Get("Content-Range") != "bytes 2-5/16" {
+		t.Fatalf("single range error: %v %v %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = serveFileRequest(srv, "/static/data.txt", map[string]string{"Range": "bytes=0-1,-2"})
+	mediaType, params, _ := mime.ParseMediaType(w.Header().Get(ContentType))
+	if w.Code != StatusPartialContent || mediaType != "multipart/byteranges" {
+		t.Fatalf("multi range error: %v %v", w.Code, w.Header())
+	}
+	reader := multipart.NewReader(w.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := ioutil.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Range")+"="+string(data))
+	}
+	if strings.Join(parts, "|") != "bytes 0-1/16=01|bytes 14-15/16=ef" {
+		t.Fatalf("multi range parts error: %v", parts)
+	}
+
+	info, _ := os.Stat(filepath.Join(root, "data.txt"))
+	modified := info.ModTime().UTC().Format(HttpTimeFormattor)
+	w = serveFileRequest(srv, "/static/data.txt", map[string]string{"Range": "bytes=0-1", "If-Range": modified})
+	if w.Code != StatusPartialContent {
+		t.Fatalf("if-range match error: %v", w.Code)
+	}
+	stale := info.ModTime().Add(-time.Hour).UTC().Format(HttpTimeFormattor)
+	w = serveFileRequest(srv, "/static/data.txt", map[string]string{"Range": "bytes=0-1", "If-Range": stale})
+	if w.Code != StatusOK || w.Body.Len() != 16 {
+		t.Fatalf("if-range mismatch error: %v %v", w.Code, w.Body.Len())
+	}
+
+	w = serveFileRequest(srv, "/static/data.txt", map[string]string{"Range": "bytes=100-"})
+	if w.Code != StatusRequestedRangeNotSatisfiable || w.Header().Get("Content-Range") != "bytes */16" {
+		t.Fatalf("unsatisfiable range error: %v %v", w.Code, w.Header())
+	}
+}
+
+func TestFileServerDirectory(t *testing.T) {
+	_, srv := fileServerFixture(t)
+	w := serveFileRequest(srv, "/static/site", nil)
+	if w.Code != StatusMovedPermanently || w.Header().Get("Location") != "site/" {
+		t.Fatalf("directory redirect error: %v %v", w.Code, w.Header())
+	}
+	w = serveFileRequest(srv, "/static/site/", nil)
+	if w.Code != StatusOK || w.Body.String() != "<h1>index</h1>" {
+		t.Fatalf("index error: %v %v", w.Code, w.Body.String())
+	}
+
+	w = serveFileRequest(srv, "/static/files/", map[string]string{"Accept": "application/json"})
+	var entries []FileEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("listing json error: %v %v", err, w.Body.String())
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	if strings.Join(names, ",") != "dir/,big.txt,small.txt" {
+		t.Fatalf("listing order error: %v", names)
+	}
+
+	req := httptest.NewRequest(GET, "/static/files/?sort=size&order=asc", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	body := w.Body.String()
+	if w.Code != StatusOK || strings.Contains(body, ".hidden") ||
+		strings.Index(body, "small.txt") > strings.Index(body, "big.txt") || !strings.Contains(body, `href="?sort=size&order=desc"`) {
+		t.Fatalf("html listing error: %v\n%v", w.Code, body)
+	}
+}
+
+func TestFileServerEscape(t *testing.T) {
+	_, srv := fileServerFixture(t)
+	for _, target := range []string{"/static/../../../etc/passwd", "/static/escape", "/static/files/../../escape"} {
+		if w := serveFileRequest(srv, target, nil); w.Code != StatusNotFound {
+			t.Fatalf("escape not blocked: %v %v", target, w.Code)
+		}
+	}
+	if w := serveFileRequest(srv, "/static/files/../data.txt", nil); w.Code != StatusOK || w.Body.String() != "0123456789abcdef" {
+		t.Fatalf("clean path error: %v", w.Code)
+	}
+}
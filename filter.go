@@ -9,21 +9,34 @@ import (
 注册过滤器
 
 handle : return false 拦截请求
+
+过滤器作为中间件, 与 Use 注册的中间件按注册顺序执行
 */
 func (t *Server) RegisterFilter(path string, handle func(Context) bool) {
-	t.Lock()
-	defer t.Unlock()
-	if len(path) <= 0 {
+	t.RegisterFilterFunc(path, WrapFilter(handle))
+}
+
+/*
+RegisterFilterFunc 注册过滤器, 过滤器以指针接收 Context
+
+filter : return false 拦截请求
+*/
+func (t *Server) RegisterFilterFunc(path string, filter FilterFunc) {
+	if len(path) <= 0 || filter == nil {
 		return
 	}
 	if strings.HasSuffix(path, "/") {
 		path = path + ".*"
 	}
-	t.filter = append(t.filter, filterProcessor{
-		handler: handle,
-		pathReg: regexp.MustCompile(path),
+	pathReg := regexp.MustCompile(path)
+	m := FilterFuncMiddleware(filter)
+	t.Use(func(ctx *Context, next func()) {
+		if !pathReg.MatchString(ctx.Request.URL.Path) {
+			next()
+			return
+		}
+		m(ctx, next)
 	})
-
 }
 
 /*
@@ -35,8 +48,11 @@ func RegisterFilter(path string, handle func(Context) bool) {
 	globalServer.RegisterFilter(path, handle)
 }
 
-type filterProcessor struct {
-	pathReg *regexp.Regexp
-	params  []string
-	handler func(Context) bool
+/*
+RegisterFilterFunc 在全局Server注册过滤器
+
+filter : return false 拦截请求
+*/
+func RegisterFilterFunc(path string, filter FilterFunc) {
+	globalServer.RegisterFilterFunc(path, filter)
 }
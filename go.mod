@@ -5,6 +5,7 @@ go 1.17
 require (
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/gorilla/websocket v1.5.0
+	github.com/klauspost/compress v1.15.3
 	github.com/segmentio/kafka-go v0.4.31
 	github.com/shirou/gopsutil/v3 v3.22.5
 	github.com/wenlaizhou/etree v1.0.1
@@ -13,7 +14,6 @@ require (
 
 require (
 	github.com/go-ole/go-ole v1.2.6 // indirect
-	github.com/klauspost/compress v1.15.3 // indirect
 	github.com/lufia/plan9stats v0.0.0-20220517141722-cf486979b281 // indirect
 	github.com/pierrec/lz4/v4 v4.1.14 // indirect
 	github.com/power-devops/perfstat v0.0.0-20220216144756-c35f1ee13d7c // indirect
@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Router 路由注册接口, Server 与 Group 均实现该接口
+type Router interface {
+	// Prefix 路由路径前缀, Server 为空
+	Prefix() string
+
+	// RegisterHandler 注册匹配所有http方法的处理器
+	RegisterHandler(path string, handler func(Context))
+
+	// Any 注册匹配所有http方法的处理器
+	Any(path string, handler func(Context), middlewares ...Middleware)
+
+	// Handle 注册指定http方法的处理器
+	Handle(method string, path string, handler func(Context), middlewares ...Middleware) *SwaggerPath
+
+	// Route 注册以指针接收 Context 的处理器, method 为空则匹配所有http方法
+	Route(method string, path string, handler HandlerFunc, middlewares ...Middleware) *SwaggerPath
+
+	GET(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath
+
+	POST(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath
+
+	PUT(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath
+
+	PATCH(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath
+
+	DELETE(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath
+
+	// Group 创建子路由分组
+	Group(prefix string) *Group
+}
+
+// Group 路由分组
+//
+// 组内注册的路由自动添加路径前缀, 并先执行上级分组及本分组的中间件,
+// 按http方法注册的路由自动归入分组对应的swagger group, 未设置跨域策略时使用上级分组的策略
+type Group struct {
+	server       *Server
+	parent       *Group
+	prefix       string
+	swaggerGroup string
+	middlewares  []Middleware
+	cors         *CorsPolicy
+	sync.RWMutex
+}
+
+// Group 创建路由分组
+//
+// prefix: 分组路径前缀, 如 /api/v1
+func (t *Server) Group(prefix string) *Group {
+	prefix = normalizeGroupPrefix(prefix)
+	return &Group{
+		server:       t,
+		prefix:       prefix,
+		swaggerGroup: prefix,
+	}
+}
+
+// Prefix Server 路由无前缀
+func (t *Server) Prefix() string {
+	return ""
+}
+
+// Group 创建嵌套路由分组, 前缀及过滤器继承自上级分组
+func (g *Group) Group(prefix string) *Group {
+	prefix = fmt.Sprintf("%s%s", g.prefix, normalizeGroupPrefix(prefix))
+	return &Group{
+		server:       g.server,
+		parent:       g,
+		prefix:       prefix,
+		swaggerGroup: prefix,
+	}
+}
+
+// Prefix 分组完整路径前缀
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// SwaggerGroup 设置分组路由在swagger中的分组名称, 默认为分组前缀
+func (g *Group) SwaggerGroup(name string) *Group {
+	g.Lock()
+	defer g.Unlock()
+	g.swaggerGroup = name
+	return g
+}
+
+/*
+Filter 注册分组过滤器, 只对该分组及子分组内的路由生效
+
+handle : return false 拦截请求
+*/
+func (g *Group) Filter(handle func(Context) bool) *Group {
+	return g.FilterFunc(WrapFilter(handle))
+}
+
+// FilterFunc 注册以指针接收 Context 的分组过滤器
+func (g *Group) FilterFunc(filter FilterFunc) *Group {
+	if filter == nil {
+		return g
+	}
+	return g.Use(FilterFuncMiddleware(filter))
+}
+
+// Use 注册分组中间件, 只对该分组及子分组内的路由生效
+func (g *Group) Use(middlewares ...Middleware) *Group {
+	g.Lock()
+	defer g.Unlock()
+	for _, m := range middlewares {
+		if m != nil {
+			g.middlewares = append(g.middlewares, m)
+		}
+	}
+	return g
+}
+
+// RegisterHandler 注册匹配所有http方法的处理器, path 自动添加分组前缀
+func (g *Group) RegisterHandler(path string, handler func(Context)) {
+	g.Any(path, handler)
+}
+
+// Any 注册匹配所有http方法的处理器, path 自动添加分组前缀
+func (g *Group) Any(path string, handler func(Context), middlewares ...Middleware) {
+	if handler == nil {
+		return
+	}
+	fullPath := g.fullPath(path)
+	g.server.handle("", fullPath, g.wrap(WrapHandler(handler), middlewares))
+	g.server.bindRouteGroup(fullPath, g)
+}
+
+// Handle 注册指定http方法的处理器, path 自动添加分组前缀
+func (g *Group) Handle(method string, path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return g.Route(method, path, WrapHandler(handler), middlewares...)
+}
+
+// Route 注册以指针接收 Context 的处理器, path 自动添加分组前缀, method 为空则匹配所有http方法
+func (g *Group) Route(method string, path string, handler HandlerFunc, middlewares ...Middleware) *SwaggerPath {
+	if handler == nil {
+		return g.server.Route(method, g.fullPath(path), nil)
+	}
+	fullPath := g.fullPath(path)
+	swaggerPath := g.server.Route(method, fullPath, g.wrap(handler, middlewares))
+	g.server.bindRouteGroup(fullPath, g)
+	g.RLock()
+	swaggerPath.Group = g.swaggerGroup
+	g.RUnlock()
+	return swaggerPath
+}
+
+func (g *Group) GET(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return g.Handle(GET, path, handler, middlewares...)
+}
+
+func (g *Group) POST(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return g.Handle(POST, path, handler, middlewares...)
+}
+
+func (g *Group) PUT(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return g.Handle(PUT, path, handler, middlewares...)
+}
+
+func (g *Group) PATCH(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return g.Handle(PATCH, path, handler, middlewares...)
+}
+
+func (g *Group) DELETE(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return g.Handle(DELETE, path, handler, middlewares...)
+}
+
+func (g *Group) fullPath(path string) string {
+	if len(path) > 0 && !strings.HasPrefix(path, "/") {
+		path = fmt.Sprintf("/%s", path)
+	}
+	if len(g.prefix) <= 0 && len(path) <= 0 {
+		return "/"
+	}
+	return fmt.Sprintf("%s%s", g.prefix, path)
+}
+
+// wrap 处理器执行前执行分组中间件及路由中间件, 分组中间件在请求时读取, 注册路由后添加的中间件同样生效
+func (g *Group) wrap(handler HandlerFunc, middlewares []Middleware) HandlerFunc {
+	return func(ctx *Context) {
+		runMiddlewares(ctx, append(g.chain(), middlewares...), func() {
+			handler(ctx)
+		})
+	}
+}
+
+// chain 上级分组及本分组的中间件
+func (g *Group) chain() []Middleware {
+	var res []Middleware
+	if g.parent != nil {
+		res = g.parent.chain()
+	}
+	g.RLock()
+	defer g.RUnlock()
+	return append(res, g.middlewares...)
+}
+
+// normalizeGroupPrefix 前缀以 / 开头, 不以 / 结尾
+func normalizeGroupPrefix(prefix string) string {
+	prefix = strings.TrimSpace(prefix)
+	prefix = strings.TrimSuffix(prefix, "/")
+	if len(prefix) > 0 && !strings.HasPrefix(prefix, "/") {
+		prefix = fmt.Sprintf("/%s", prefix)
+	}
+	return prefix
+}
+
+// NewGroup 在全局Server上创建路由分组
+func NewGroup(prefix string) *Group {
+	return globalServer.Group(prefix)
+}
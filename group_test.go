@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	srv := NewServer("", 0)
+	api := srv.Group("/api").Filter(func(c Context) bool {
+		if len(c.GetHeader("token")) <= 0 {
+			c.Code(StatusUnauthorized)
+			return false
+		}
+		return true
+	})
+	v1 := api.Group("v1/").SwaggerGroup("v1")
+	swaggerPath := v1.GET("/user/{id}", func(c Context) {
+		c.OK(Plain, []byte(c.GetPathParam("id")))
+	})
+	if swaggerPath.Path != "/api/v1/user/{id}" || swaggerPath.Group != "v1" {
+		t.Fatalf("swagger path error: %v %v", swaggerPath.Path, swaggerPath.Group)
+	}
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/api/v1/user/1", nil))
+	if w.Code != StatusUnauthorized {
+		t.Fatalf("group filter not work: %v", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(GET, "/api/v1/user/1", nil)
+	req.Header.Set("token", "1")
+	srv.ServeHTTP(w, req)
+	if w.Code != StatusOK || w.Body.String() != "1" {
+		t.Fatalf("group route error: %v %v", w.Code, w.Body.String())
+	}
+}
@@ -1,9 +1,10 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"html/template"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -11,6 +12,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/wenlaizhou/middleware/metrics"
 )
 
 var mLogger = GetLogger("middleware")
@@ -20,29 +23,41 @@ type Server struct {
 	Host           string
 	Port           int
 	baseTpl        *template.Template
-	pathNodes      map[string]pathProcessor
+	router         *TrieNode
 	index          pathProcessor
 	restProcessors []func(model interface{}) interface{}
 	hasIndex       bool
-	CrossDomain    bool
+	CrossDomain    bool // Deprecated: 使用 SetCors 配置跨域策略, 未配置策略时为 true 则允许所有来源
 	status         int
-	filter         []filterProcessor
+	middlewares    []Middleware
 	i18n           I18n
 	enableI18n     bool
 	swagger        *SwaggerData
+	httpServer     *http.Server
+	shutdownHooks  []func()
+	done           chan struct{}
+	certReloader   *certReloader
+	redirectServer *http.Server
+	errorRenderer  ErrorRenderer
+	panicHooks     []PanicHook
+	accessLog      *accessLog
+	httpMetrics    *httpMetrics
+	limitMetrics   *limitMetrics
+	registry       *metrics.Registry
+	cors           *CorsPolicy
 	sync.RWMutex
 }
 
 // 默认全局单一http服务
 var globalServer = NewServer("", 0)
 
-// 启动服务
-func StartServer(host string, port int) {
+// 启动服务, 监听或服务出错时返回错误, 由调用方决定是否退出
+func StartServer(host string, port int) error {
 	globalServer.Lock()
 	globalServer.Host = host
 	globalServer.Port = port
 	globalServer.Unlock()
-	globalServer.Start()
+	return globalServer.Start()
 }
 
 // 获取全局唯一Server
@@ -65,101 +80,174 @@ func NewServer(host string, port int) *Server {
 			Description: "",
 			Host:        "",
 		},
+		accessLog: &accessLog{
+			conf:   AccessLogConfig{Format: AccessLogDefault},
+			tokens: parseAccessLogFormat(AccessLogDefault),
+			logger: accessLogger,
+		},
+		httpMetrics:  newHttpMetrics(HttpMetricsConfig{}),
+		limitMetrics: newLimitMetrics(),
 	}
 
-	srv.pathNodes = make(map[string]pathProcessor)
+	srv.router = NewTrieNode(nil)
+	srv.registry = metrics.NewRegistry()
+	srv.registry.MustRegister(metrics.CollectorFunc(srv.collectHttpMetrics),
+		srv.limitMetrics.rateLimitRejected, srv.limitMetrics.concurrencyLimitRejected)
 	return &srv
 }
 
+// GetStatus 获取服务状态: ServerIdle, ServerStarting, ServerRunning, ServerDraining, ServerStopped
 func (t *Server) GetStatus() int {
 	t.RLock()
 	defer t.RUnlock()
 	return t.status
 }
 
-func (t *Server) Start() {
+func (t *Server) setStatus(status int) {
+	t.Lock()
+	t.status = status
+	t.Unlock()
+}
+
+// compareAndSetStatus 状态为 from 时设置为 to, 避免覆盖启动期间 Shutdown 设置的状态
+func (t *Server) compareAndSetStatus(from int, to int) bool {
+	t.Lock()
+	defer t.Unlock()
+	if t.status != from {
+		return false
+	}
+	t.status = to
+	return true
+}
+
+// Start 启动服务, 阻塞直至服务关闭
+//
+// 调用 Shutdown 后, 待请求处理完毕及关闭钩子执行完成后返回 nil;
+// 监听失败时返回错误, 服务出错时执行关闭钩子后返回错误, 由调用方决定是否退出
+//
+//	if err := srv.Start(); err != nil {
+//		os.Exit(1)
+//	}
+func (t *Server) Start() error {
 	defer func() {
 		if err := recover(); err != nil {
 			mLogger.ErrorF("%v", err)
 		}
 	}()
 	t.Lock()
-	if t.status != 0 {
+	if t.status != ServerIdle {
 		t.Unlock()
-		return
+		return nil
 	}
-	t.status = 1
-	t.Unlock()
-	http.HandleFunc("/", t.ServeHTTP)
+	t.status = ServerStarting
 	hostStr := fmt.Sprintf("%s:%d", t.Host, t.Port)
-	mLogger.Info("server start " + hostStr)
-	log.Fatal(http.ListenAndServe(hostStr, nil))
+	httpServer := &http.Server{
+		Addr:    hostStr,
+		Handler: t,
+	}
+	done := make(chan struct{})
+	t.httpServer = httpServer
+	t.done = done
+	t.Unlock()
+	listener, err := net.Listen("tcp", hostStr)
+	if err != nil {
+		mLogger.ErrorF("server listen error: %v", err.Error())
+		// 未开始服务, 恢复为未启动状态, 启动期间已调用 Shutdown 时由其关闭 done
+		t.Lock()
+		if t.status == ServerStarting {
+			t.status = ServerIdle
+			t.httpServer = nil
+			t.done = nil
+			close(done)
+		}
+		t.Unlock()
+		return err
+	}
+	listener = t.serveTLS(listener, done)
+	if t.compareAndSetStatus(ServerStarting, ServerRunning) {
+		mLogger.Info("server start " + hostStr)
+	}
+	if err = httpServer.Serve(listener); err != http.ErrServerClosed {
+		mLogger.ErrorF("server error: %v", err.Error())
+		_ = t.Shutdown(context.Background())
+		<-done
+		return err
+	}
+	<-done
+	mLogger.Info("server stopped " + hostStr)
+	return nil
 }
 
 var accessLogger = GetCleanLogger("access")
 
 // 核心处理逻辑
 func (t *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	start := TimeEpoch()
-	startTime := time.Now().Format(TimeFormat)
-	ctx := newContext(w, r)
+	start := time.Now()
+	ctx := acquireContext(w, r)
+	defer releaseContext(ctx)
 	ctx.tpl = t.baseTpl
 	ctx.restProcessors = t.restProcessors
+	ctx.limits = t.limitMetrics
 	ctx.code = 200 // 是否合适
-	defer func() {
-		accessLogger.LogF(`"%v", "%v", "%v", "%v", %v, %v`, startTime, ctx.Request.RequestURI, ctx.Request.RemoteAddr, ctx.GetMethod(), ctx.code, TimeEpoch()-start)
-	}()
+	ctx.trace = newTraceContext(r)
+	ctx.Request = r.WithContext(WithTrace(r.Context(), ctx.trace))
+	ctx.SetHeader(RequestIdHeader, ctx.trace.RequestId)
+	ctx.access = &accessRecord{}
+	t.RLock()
+	access := t.accessLog
+	metrics := t.httpMetrics
+	t.RUnlock()
+	defer access.log(ctx, start)
+	if metrics.begin() {
+		defer metrics.end(ctx, start)
+	}
+	defer ctx.FlushResponse()
+	defer t.recoverPanic(ctx)
 	if t.enableI18n {
 		ctx.EnableI18n = true
 		ctx.Message = t.i18n
 	}
-	if t.CrossDomain {
-		ctx.SetHeader(AccessControlAllowOrigin, "*")
-		ctx.SetHeader(AccessControlAllowMethods, METHODS)
-		ctx.SetHeader(AccessControlAllowHeaders, "*")
-
-		if strings.ToUpper(ctx.GetMethod()) == OPTIONS {
-			ctx.Code(202)
-			return
-		}
+	t.RLock()
+	matched, pathParams := t.router.lookup(r.URL.Path)
+	if matched != nil {
+		ctx.route = matched.pattern
 	}
-	for _, filterNode := range t.filter {
-		if filterNode.pathReg.MatchString(r.URL.Path) {
-			if !filterNode.handler(ctx) {
-				return
-			}
+	t.RUnlock()
+	if origin := ctx.GetHeader(Origin); len(origin) > 0 {
+		if policy := t.corsPolicy(matched); policy != nil && policy.handle(ctx, origin, matched) {
+			return
 		}
 	}
-	if t.hasIndex && r.URL.Path == "/" {
+	t.RLock()
+	middlewares := t.middlewares
+	t.RUnlock()
+	runMiddlewares(ctx, middlewares, func() {
+		t.dispatch(ctx, matched, pathParams)
+	})
+}
+
+// dispatch 执行路由对应处理器
+func (t *Server) dispatch(ctx *Context, matched *route, pathParams map[string]string) {
+	if t.hasIndex && ctx.Request.URL.Path == "/" {
 		t.index.handler(ctx)
 		return
 	}
-	var handler func(Context)
-	for _, pathNode := range t.pathNodes {
-		if pathNode.pathReg.MatchString(r.URL.Path) {
-			if len(pathNode.params) <= 0 {
-				handler = pathNode.handler
-				break
-			}
-			pathParams := pathNode.pathReg.FindAllStringSubmatch(r.URL.Path, 10) // 最多10个路径参数
-			if len(pathParams) > 0 && len(pathParams[0]) > 0 {
-				for i, pathParam := range pathParams[0][1:] {
-					if len(pathNode.params) < i+1 {
-						break
-					}
-					ctx.pathParams[pathNode.params[i]] = pathParam
-				}
-			}
-			handler = pathNode.handler
-			break
-		}
+	if matched == nil {
+		ctx.Error(StatusNotFound, StatusNotFoundView)
+		return
 	}
+	ctx.pathParams = pathParams
+	handler := matched.methodHandler(strings.ToUpper(ctx.GetMethod()))
 	if handler == nil {
-		ctx.Error(StatusNotFound, StatusNotFoundView)
+		ctx.SetHeader(Allow, matched.allow())
+		if strings.ToUpper(ctx.GetMethod()) == OPTIONS {
+			ctx.Code(StatusNoContent)
+			return
+		}
+		ctx.Error(StatusMethodNotAllowed, StatusMethodNotAllowedView)
 		return
 	}
 	handler(ctx)
-	return
 }
 
 type defaultIndexStruct struct {
@@ -269,7 +357,7 @@ func (t *Server) RegisterIndex(handler func(Context)) {
 	defer t.Unlock()
 	t.hasIndex = true
 	t.index = pathProcessor{
-		handler: handler,
+		handler: WrapHandler(handler),
 	}
 }
 
@@ -421,50 +509,13 @@ func SetI18n(name string) {
 	globalServer.SetI18n(name)
 }
 
-var pathParamReg, _ = regexp.Compile("\\{(.+?)\\}")
-
-// 注册服务
+// 注册服务, 匹配所有http方法
+//
+// path: 可以用 {占位符} 进行路径参数设置, 占位符匹配一个路径分段
+//
+// 以 / 结尾的路径匹配该路径之下的所有路径, 静态分段优先于占位符, 占位符优先于 / 结尾的路径
 func (t *Server) RegisterHandler(path string, handler func(Context)) {
-	t.Lock()
-	defer t.Unlock()
-	if len(path) <= 0 {
-		return
-	}
-	if handler == nil {
-		return
-	}
-
-	var params = []string{}
-
-	paramMather := pathParamReg.FindAllStringSubmatch(path, -1)
-
-	for _, param := range paramMather {
-		params = append(params, param[1])
-		path = strings.Replace(path,
-			param[0], "(.+?)", -1)
-	}
-
-	if strings.HasSuffix(path, "/") {
-		path = fmt.Sprintf("%s.*", path)
-	} else {
-		path = fmt.Sprintf("%s$", path)
-	}
-
-	if !strings.HasPrefix(path, "/") {
-		path = fmt.Sprintf("/%s", path)
-	}
-
-	path = fmt.Sprintf("^%s", path)
-
-	pathReg, err := regexp.Compile(path)
-	mLogger.InfoF("注册handler: %s", path)
-	if !ProcessError(err) {
-		t.pathNodes[path] = pathProcessor{
-			pathReg: pathReg,
-			handler: handler,
-			params:  params,
-		}
-	}
+	t.handle("", path, WrapHandler(handler))
 }
 
 func (t *Server) RegisterRestProcessor(processor func(model interface{}) interface{}) {
@@ -475,20 +526,11 @@ func (t *Server) RegisterRestProcessor(processor func(model interface{}) interfa
 }
 
 type pathProcessor struct {
-	pathReg *regexp.Regexp
-	params  []string
-	handler func(Context)
-}
-
-type starProcessor struct {
-	pathReg *regexp.Regexp
-	handler func(Context)
+	handler HandlerFunc
 }
 
-func StaticProcessor(ctx Context) {
-	ctx.code = 200
-	http.ServeFile(ctx.Response, ctx.Request, ctx.Request.URL.Path[1:])
-}
+// StaticProcessor 以工作目录为根目录返回请求路径对应的文件, 目录下不存在 index.html 时返回目录列表
+var StaticProcessor = FileServer(FileServerConfig{Browse: true})
 
 // 错误处理
 //
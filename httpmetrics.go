@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wenlaizhou/middleware/metrics"
+)
+
+// DefaultLatencyBuckets 默认请求耗时直方图分桶, 单位: 秒
+var DefaultLatencyBuckets = metrics.DefBuckets
+
+// DefaultSizeBuckets 默认请求及响应大小直方图分桶, 单位: 字节
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+// unmatchedRoute 未匹配路由的请求使用的 route 标签, 避免以原始路径作为标签
+const unmatchedRoute = "unmatched"
+
+// HttpMetricsConfig http请求指标配置
+type HttpMetricsConfig struct {
+	// LatencyBuckets 请求耗时分桶, 单位: 秒, 为空则使用 DefaultLatencyBuckets
+	LatencyBuckets []float64
+
+	// SizeBuckets 请求及响应大小分桶, 单位: 字节, 为空则使用 DefaultSizeBuckets
+	SizeBuckets []float64
+
+	// Disable 关闭请求指标
+	Disable bool
+}
+
+// httpMetrics http请求指标
+//
+// route 标签使用注册的路由路径, 如 /user/{id}, 保证标签数量可控
+type httpMetrics struct {
+	conf         HttpMetricsConfig
+	registry     *metrics.Registry
+	requests     *metrics.CounterVec
+	inflight     *metrics.Gauge
+	latency      *metrics.HistogramVec
+	requestSize  *metrics.HistogramVec
+	responseSize *metrics.HistogramVec
+}
+
+func newHttpMetrics(conf HttpMetricsConfig) *httpMetrics {
+	if len(conf.LatencyBuckets) <= 0 {
+		conf.LatencyBuckets = DefaultLatencyBuckets
+	}
+	if len(conf.SizeBuckets) <= 0 {
+		conf.SizeBuckets = DefaultSizeBuckets
+	}
+	m := &httpMetrics{
+		conf:     conf,
+		registry: metrics.NewRegistry(),
+		requests: metrics.NewCounterVec(metrics.Opts{
+			Name: "http_requests_total",
+			Help: "Total number of http requests.",
+		}, "route", "method", "status"),
+		inflight: metrics.NewGauge(metrics.Opts{
+			Name: "http_requests_in_flight",
+			Help: "Number of http requests currently being served.",
+		}),
+		latency: metrics.NewHistogramVec(metrics.HistogramOpts{
+			Opts: metrics.Opts{
+				Name: "http_request_duration_seconds",
+				Help: "Http request latency in seconds.",
+			},
+			Buckets: conf.LatencyBuckets,
+		}, "route", "method"),
+		requestSize: metrics.NewHistogramVec(metrics.HistogramOpts{
+			Opts: metrics.Opts{
+				Name: "http_request_size_bytes",
+				Help: "Http request body size in bytes.",
+			},
+			Buckets: conf.SizeBuckets,
+		}, "route", "method"),
+		responseSize: metrics.NewHistogramVec(metrics.HistogramOpts{
+			Opts: metrics.Opts{
+				Name: "http_response_size_bytes",
+				Help: "Http response body size in bytes.",
+			},
+			Buckets: conf.SizeBuckets,
+		}, "route", "method"),
+	}
+	m.registry.MustRegister(m.requests, m.inflight, m.latency, m.requestSize, m.responseSize)
+	return m
+}
+
+// begin 请求开始, 返回 false 则不记录该请求
+func (m *httpMetrics) begin() bool {
+	if m == nil || m.conf.Disable {
+		return false
+	}
+	m.inflight.Inc()
+	return true
+}
+
+// end 请求结束, 记录请求数, 耗时及大小
+func (m *httpMetrics) end(ctx *Context, start time.Time) {
+	m.inflight.Dec()
+	status, size := ctx.responseState()
+	route := ctx.route
+	if len(route) <= 0 {
+		route = unmatchedRoute
+	}
+	method := strings.ToUpper(ctx.GetMethod())
+	if !isRouteMethod(method) {
+		method = "OTHER"
+	}
+	requestSize := ctx.Request.ContentLength
+	if requestSize < 0 {
+		requestSize = 0
+	}
+	m.requests.WithLabelValues(route, method, fmt.Sprintf("%dxx", status/100)).Inc()
+	m.latency.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	m.requestSize.WithLabelValues(route, method).Observe(float64(requestSize))
+	m.responseSize.WithLabelValues(route, method).Observe(float64(size))
+}
+
+func (m *httpMetrics) Collect() []metrics.Family {
+	if m == nil || m.conf.Disable {
+		return nil
+	}
+	return m.registry.Collect()
+}
+
+// SetHttpMetrics 设置http请求指标, 会清空已记录的指标
+func (t *Server) SetHttpMetrics(conf HttpMetricsConfig) {
+	t.Lock()
+	defer t.Unlock()
+	t.httpMetrics = newHttpMetrics(conf)
+}
+
+// Metrics 服务指标注册表, 包含http请求指标, 可注册自定义指标
+func (t *Server) Metrics() *metrics.Registry {
+	return t.registry
+}
+
+// collectHttpMetrics 收集当前的http请求指标, SetHttpMetrics 后自动使用新的指标
+func (t *Server) collectHttpMetrics() []metrics.Family {
+	t.RLock()
+	m := t.httpMetrics
+	t.RUnlock()
+	return m.Collect()
+}
+
+// HttpMetrics http请求指标, Prometheus 文本格式
+//
+// http_requests_total, http_requests_in_flight, http_request_duration_seconds, http_request_size_bytes, http_response_size_bytes
+func (t *Server) HttpMetrics() string {
+	buf := &bytes.Buffer{}
+	_ = metrics.WritePrometheus(buf, metrics.MergeFamilies(t.collectHttpMetrics()))
+	return buf.String()
+}
+
+// SetHttpMetrics 设置全局Server http请求指标
+func SetHttpMetrics(conf HttpMetricsConfig) {
+	globalServer.SetHttpMetrics(conf)
+}
+
+// GetHttpMetrics 全局Server http请求指标, Prometheus 文本格式
+func GetHttpMetrics() string {
+	return globalServer.HttpMetrics()
+}
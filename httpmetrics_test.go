@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHttpMetrics(t *testing.T) {
+	srv := NewServer("", 0)
+	srv.SetHttpMetrics(HttpMetricsConfig{LatencyBuckets: []float64{1, 0.1}})
+	srv.GET("/user/{id}", func(c Context) {
+		c.OK(Plain, []byte("user"))
+	})
+	srv.GET("/panic", func(c Context) {
+		panic("metrics")
+	})
+	for _, path := range []string{"/user/1", "/user/2", "/none", "/panic"} {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, path, nil))
+	}
+	text := srv.HttpMetrics()
+	for _, line := range []string{
+		"# TYPE http_requests_total counter",
+		`http_requests_total{route="/user/{id}",method="GET",status="2xx"} 2`,
+		`http_requests_total{route="unmatched",method="GET",status="4xx"} 1`,
+		`http_requests_total{route="/panic",method="GET",status="5xx"} 1`,
+		"http_requests_in_flight 0",
+		`http_request_duration_seconds_bucket{route="/user/{id}",method="GET",le="0.1"} 2`,
+		`http_request_duration_seconds_bucket{route="/user/{id}",method="GET",le="+Inf"} 2`,
+		`http_response_size_bytes_sum{route="/user/{id}",method="GET"} 8`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("metrics missing %v:\n%v", line, text)
+		}
+	}
+	if strings.Index(text, `le="0.1"`) > strings.Index(text, `le="1"`) {
+		t.Fatalf("metrics buckets order error:\n%v", text)
+	}
+}
+
+func TestMetricsDataCollector(t *testing.T) {
+	text := GetMetricsData([]MetricsData{
+		{Key: "connections", Value: 3, Tags: map[string]string{"host": "a\"b", "app": "m"}},
+		{Key: "connections", Value: 4, Tags: map[string]string{"host": "c", "app": "m"}},
+	})
+	expected := "# TYPE connections gauge\nconnections{app=\"m\",host=\"a\\\"b\"} 3\nconnections{app=\"m\",host=\"c\"} 4\n"
+	if text != expected {
+		t.Fatalf("metrics data error:\n%v", text)
+	}
+
+	srv := NewServer("", 0)
+	srv.GET("/metrics", func(c Context) {
+		WriteMetrics(c, srv.Metrics())
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(GET, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	srv.ServeHTTP(w, req)
+	if !strings.HasPrefix(w.Header().Get(ContentType), "application/openmetrics-text") || !strings.HasSuffix(w.Body.String(), "# EOF\n") {
+		t.Fatalf("openmetrics error: %v\n%v", w.Header(), w.Body.String())
+	}
+}
@@ -29,6 +29,12 @@ type MessageHandler struct {
 
 	// timeoutSeconds 超时时间,单位 秒, 默认为20秒
 	timeoutSeconds int
+
+	// ctx 消息订阅上下文, Close 时取消
+	ctx context.Context
+
+	// cancel 停止所有消息订阅
+	cancel context.CancelFunc
 }
 
 // MessageStats 消息统计信息
@@ -59,6 +65,13 @@ type MessageStats struct {
 //
 // messages 多条消息
 func (this *MessageHandler) Send(messages ...kafka.Message) error {
+	return this.SendContext(context.Background(), messages...)
+}
+
+// SendContext 发送多条消息, ctx 中包含追踪信息时自动添加 X-Request-Id, traceparent, tracestate 消息头
+//
+// 处理http请求时使用 Context.Ctx() 作为 ctx, 请求取消或超时后停止发送
+func (this *MessageHandler) SendContext(ctx context.Context, messages ...kafka.Message) error {
 	if messages == nil || len(messages) <= 0 {
 		return errors.New("未传递message")
 	}
@@ -69,8 +82,19 @@ func (this *MessageHandler) Send(messages ...kafka.Message) error {
 			return errors.New(fmt.Sprintf("kafka连接初始化错误: %v", err.Error()))
 		}
 	}
+	if trace, ok := TraceFromContext(ctx); ok {
+		var headers []kafka.Header
+		for k, v := range trace.Headers() {
+			headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+		// 复制消息, 避免修改调用方的消息头
+		messages = append([]kafka.Message(nil), messages...)
+		for i := range messages {
+			messages[i].Headers = append(append([]kafka.Header(nil), messages[i].Headers...), headers...)
+		}
+	}
 	this.sendMessageCounter += uint64(len(messages))
-	return this.writer.WriteMessages(context.Background(), messages...)
+	return this.writer.WriteMessages(ctx, messages...)
 }
 
 // Stats 获取消息统计信息
@@ -105,6 +129,7 @@ func CreateMessageHandler(kafkaServers string, timeoutSeconds int) (MessageHandl
 		timeoutSeconds:        timeoutSeconds,
 		startTime:             time.Now(),
 	}
+	res.ctx, res.cancel = context.WithCancel(context.Background())
 	if len(kafkaServers) <= 0 {
 		return res, errors.New("kafka server 为空")
 	}
@@ -129,8 +154,28 @@ func (this *MessageHandler) connectKafka() (*kafka.Writer, error) {
 	}
 }
 
+// Close 停止所有消息订阅并关闭消息发送通道
+//
+// 可作为 Server 关闭钩子使用
+func (this *MessageHandler) Close() {
+	if this.cancel != nil {
+		this.cancel()
+	}
+	if this.writer != nil {
+		if err := this.writer.Close(); err != nil {
+			mLogger.ErrorF("kafka writer close error: %v", err.Error())
+		}
+	}
+}
+
 // RegisterConsumer 注册消息订阅
+//
+// 调用 Close 后停止消费, 已缓存的消息交由 handler 处理后退出
 func (this *MessageHandler) RegisterConsumer(topic string, groupId string, cacheSeconds int, handler func([]kafka.Message)) {
+	if this.ctx == nil {
+		this.ctx, this.cancel = context.WithCancel(context.Background())
+	}
+	ctx := this.ctx
 	go func() {
 		logger := GetLogger(fmt.Sprintf("consumer-%v-%v", topic, groupId))
 		r := kafka.NewReader(kafka.ReaderConfig{
@@ -149,6 +194,7 @@ func (this *MessageHandler) RegisterConsumer(topic string, groupId string, cache
 
 			StartOffset: kafka.LastOffset,
 		})
+		defer r.Close()
 		cache := []kafka.Message{}
 		next := time.Now().Add(time.Duration(cacheSeconds) * time.Second)
 		for {
@@ -159,7 +205,7 @@ func (this *MessageHandler) RegisterConsumer(topic string, groupId string, cache
 				cache = nil
 				next = time.Now().Add(time.Duration(cacheSeconds) * time.Second)
 			}
-			if m, err := r.ReadMessage(context.Background()); err == nil {
+			if m, err := r.ReadMessage(ctx); err == nil {
 				this.receiveMessageCounter++
 				logger.InfoF("消费消息: offset: %v, 消息时间: %v, val: %v", m.Offset, m.Time.Format(TimeFormat), string(m.Value))
 				if cacheSeconds <= 0 {
@@ -167,6 +213,12 @@ func (this *MessageHandler) RegisterConsumer(topic string, groupId string, cache
 					continue
 				}
 				cache = append(cache, m)
+			} else if ctx.Err() != nil {
+				if len(cache) > 0 {
+					handler(cache)
+				}
+				logger.InfoF("停止消费: %v, %v, %v", this.kafkaServers, topic, groupId)
+				break
 			} else {
 				logger.ErrorF("消费消息错误, %v, %v, %v, 停止消费, 错误信息: %v", this.kafkaServers, topic, groupId, err.Error())
 				break
@@ -168,6 +168,17 @@ func RotateLog() {
 	loggerLocker.Unlock()
 }
 
+// FlushLogs 将所有日志文件内容刷新至磁盘
+func FlushLogs() {
+	loggerLocker.Lock()
+	defer loggerLocker.Unlock()
+	for _, loggerInstance := range loggerContainer {
+		if loggerInstance.fs != nil {
+			_ = loggerInstance.fs.Sync()
+		}
+	}
+}
+
 var loggerContainer = map[string]logger{}
 
 var loggerLocker = sync.Mutex{}
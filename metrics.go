@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 	"strings"
+
+	"github.com/wenlaizhou/middleware/metrics"
 )
 
 type MetricsData struct {
@@ -13,6 +17,7 @@ type MetricsData struct {
 
 const metricsTpl = "%v%v %v"
 
+// FormatMetricsData 格式化单条指标, 标签按名称排序并转义
 func FormatMetricsData(data MetricsData) string {
 	if len(data.Key) <= 0 {
 		return ""
@@ -20,25 +25,98 @@ func FormatMetricsData(data MetricsData) string {
 	tagsStr := ""
 	if len(data.Tags) > 0 {
 		var tags []string
-		for k, v := range data.Tags {
-			tags = append(tags, fmt.Sprintf(`%v="%v"`, k, v))
+		for _, label := range sortedLabels(data.Tags) {
+			tags = append(tags, fmt.Sprintf(`%v="%v"`, label.Name, metrics.EscapeLabelValue(label.Value)))
 		}
 		tagsStr = fmt.Sprintf("{%v}", strings.Join(tags, ","))
 	}
 	return fmt.Sprintf(metricsTpl, data.Key, tagsStr, data.Value)
 }
 
+// PrintMetricsData 输出指标, 根据 Accept 头选择 Prometheus 或 OpenMetrics 格式
 func PrintMetricsData(data []MetricsData, context Context) {
-	context.OK("text/plain", []byte(GetMetricsData(data)))
+	WriteMetrics(context, MetricsDataCollector(func() []MetricsData {
+		return data
+	}))
 }
 
+// GetMetricsData 指标的 Prometheus 文本格式
 func GetMetricsData(data []MetricsData) string {
 	if len(data) <= 0 {
 		return ""
 	}
-	var lines []string
-	for _, metric := range data {
-		lines = append(lines, FormatMetricsData(metric))
+	return string(formatFamilies(metricsDataFamilies(data), false))
+}
+
+// MetricsDataCollector 将 MetricsData 转换为 gauge 类型的指标收集器, 每次输出时调用 fn
+func MetricsDataCollector(fn func() []MetricsData) metrics.Collector {
+	return metrics.CollectorFunc(func() []metrics.Family {
+		return metricsDataFamilies(fn())
+	})
+}
+
+// RuntimeMetricsCollector 运行时指标收集器, 同 GetRuntimeMetrics
+func RuntimeMetricsCollector(labels map[string]string) metrics.Collector {
+	return MetricsDataCollector(func() []MetricsData {
+		return GetRuntimeMetrics(labels)
+	})
+}
+
+// WriteMetrics 输出指标收集器中的指标
+//
+// Accept 头包含 application/openmetrics-text 时输出 OpenMetrics 格式, 否则输出 Prometheus 文本格式
+func WriteMetrics(context Context, collectors ...metrics.Collector) {
+	var families []metrics.Family
+	for _, collector := range collectors {
+		if collector != nil {
+			families = append(families, collector.Collect()...)
+		}
+	}
+	if strings.Contains(context.GetHeader("Accept"), "application/openmetrics-text") {
+		context.OK(metrics.OpenMetricsContentType, formatFamilies(families, true))
+		return
+	}
+	context.OK(metrics.PrometheusContentType, formatFamilies(families, false))
+}
+
+// formatFamilies 合并同名指标后输出文本格式
+func formatFamilies(families []metrics.Family, openMetrics bool) []byte {
+	families = metrics.MergeFamilies(families)
+	buf := &bytes.Buffer{}
+	if openMetrics {
+		_ = metrics.WriteOpenMetrics(buf, families)
+	} else {
+		_ = metrics.WritePrometheus(buf, families)
+	}
+	return buf.Bytes()
+}
+
+func metricsDataFamilies(data []MetricsData) []metrics.Family {
+	var families []metrics.Family
+	for _, item := range data {
+		if len(item.Key) <= 0 {
+			continue
+		}
+		families = append(families, metrics.Family{
+			Name: item.Key,
+			Type: metrics.GaugeType,
+			Samples: []metrics.Sample{{
+				Name:   item.Key,
+				Labels: sortedLabels(item.Tags),
+				Value:  float64(item.Value),
+			}},
+		})
+	}
+	return families
+}
+
+func sortedLabels(tags map[string]string) []metrics.Label {
+	labels := make([]metrics.Label, 0, len(tags))
+	for k, v := range tags {
+		labels = append(labels, metrics.Label{Name: k, Value: v})
 	}
-	return strings.Join(lines, "\n")
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels
 }
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefBuckets 默认直方图分桶, 适用于以秒为单位的请求耗时
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefObjectives 默认摘要分位数
+var DefObjectives = []float64{0.5, 0.9, 0.99}
+
+// DefMaxSamples 摘要默认保留的最近采样数
+const DefMaxSamples = 1024
+
+// HistogramOpts 直方图配置
+type HistogramOpts struct {
+	Opts
+
+	// Buckets 分桶上限, 无需包含 +Inf, 为空则使用 DefBuckets
+	Buckets []float64
+}
+
+// Histogram 直方图, 统计落入各分桶的次数
+type Histogram struct {
+	desc    *desc
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+	sync.Mutex
+}
+
+// NewHistogram 创建直方图
+func NewHistogram(opts HistogramOpts) *Histogram {
+	return newHistogram(newDesc(opts.Opts, HistogramType), normalizeBuckets(opts.Buckets))
+}
+
+func newHistogram(d *desc, buckets []float64) *Histogram {
+	return &Histogram{
+		desc:    d,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// normalizeBuckets 排序并去除 +Inf
+func normalizeBuckets(buckets []float64) []float64 {
+	if len(buckets) <= 0 {
+		buckets = DefBuckets
+	}
+	var res []float64
+	for _, bucket := range buckets {
+		if !math.IsInf(bucket, 1) {
+			res = append(res, bucket)
+		}
+	}
+	sort.Float64s(res)
+	return res
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(value float64) {
+	index := sort.SearchFloat64s(h.buckets, value)
+	h.Lock()
+	defer h.Unlock()
+	if index < len(h.counts) {
+		h.counts[index]++
+	}
+	h.count++
+	h.sum += value
+}
+
+func (h *Histogram) samples(name string, labels []Label) []Sample {
+	h.Lock()
+	defer h.Unlock()
+	res := make([]Sample, 0, len(h.buckets)+3)
+	var cumulative uint64
+	for i, bucket := range h.buckets {
+		cumulative += h.counts[i]
+		res = append(res, Sample{
+			Name:   name + "_bucket",
+			Labels: withLabel(labels, "le", formatValue(bucket)),
+			Value:  float64(cumulative),
+		})
+	}
+	res = append(res,
+		Sample{Name: name + "_bucket", Labels: withLabel(labels, "le", "+Inf"), Value: float64(h.count)},
+		Sample{Name: name + "_sum", Labels: labels, Value: h.sum},
+		Sample{Name: name + "_count", Labels: labels, Value: float64(h.count)},
+	)
+	return res
+}
+
+func (h *Histogram) Collect() []Family {
+	return []Family{h.desc.family(h.samples(h.desc.name, h.desc.constLabels))}
+}
+
+// SummaryOpts 摘要配置
+type SummaryOpts struct {
+	Opts
+
+	// Objectives 输出的分位数, 如 0.5, 0.99, 为空则使用 DefObjectives
+	Objectives []float64
+
+	// MaxSamples 计算分位数时使用的最近采样数, 为0则使用 DefMaxSamples
+	MaxSamples int
+}
+
+// Summary 摘要, 按最近的采样计算分位数
+type Summary struct {
+	desc       *desc
+	objectives []float64
+	values     []float64
+	next       int
+	count      uint64
+	sum        float64
+	sync.Mutex
+}
+
+// NewSummary 创建摘要
+func NewSummary(opts SummaryOpts) *Summary {
+	return newSummary(newDesc(opts.Opts, SummaryType), opts)
+}
+
+func newSummary(d *desc, opts SummaryOpts) *Summary {
+	objectives := opts.Objectives
+	if len(objectives) <= 0 {
+		objectives = DefObjectives
+	}
+	objectives = append([]float64(nil), objectives...)
+	sort.Float64s(objectives)
+	maxSamples := opts.MaxSamples
+	if maxSamples <= 0 {
+		maxSamples = DefMaxSamples
+	}
+	return &Summary{
+		desc:       d,
+		objectives: objectives,
+		values:     make([]float64, 0, maxSamples),
+	}
+}
+
+// Observe 记录一个观测值
+func (s *Summary) Observe(value float64) {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.values) < cap(s.values) {
+		s.values = append(s.values, value)
+	} else {
+		s.values[s.next] = value
+		s.next = (s.next + 1) % len(s.values)
+	}
+	s.count++
+	s.sum += value
+}
+
+func (s *Summary) samples(name string, labels []Label) []Sample {
+	s.Lock()
+	sorted := append([]float64(nil), s.values...)
+	count, sum := s.count, s.sum
+	s.Unlock()
+	sort.Float64s(sorted)
+	res := make([]Sample, 0, len(s.objectives)+2)
+	for _, q := range s.objectives {
+		value := math.NaN()
+		if len(sorted) > 0 {
+			value = sorted[int(math.Round(q*float64(len(sorted)-1)))]
+		}
+		res = append(res, Sample{
+			Name:   name,
+			Labels: withLabel(labels, "quantile", strconv.FormatFloat(q, 'g', -1, 64)),
+			Value:  value,
+		})
+	}
+	res = append(res,
+		Sample{Name: name + "_sum", Labels: labels, Value: sum},
+		Sample{Name: name + "_count", Labels: labels, Value: float64(count)},
+	)
+	return res
+}
+
+func (s *Summary) Collect() []Family {
+	return []Family{s.desc.family(s.samples(s.desc.name, s.desc.constLabels))}
+}
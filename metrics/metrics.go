@@ -0,0 +1,137 @@
+/*
+Package metrics 指标注册及 Prometheus, OpenMetrics 文本格式输出
+
+支持 Counter, Gauge, Histogram, Summary 及对应的标签向量, 以及基于回调的 GaugeFunc, CounterFunc
+
+	requests := metrics.NewCounterVec(metrics.Opts{Name: "jobs_total", Help: "Total jobs."}, "type")
+	metrics.MustRegister(requests)
+	requests.WithLabelValues("email").Inc()
+
+输出时指标按名称排序, 常量标签按名称排序后位于向量标签之前, 向量标签按声明顺序输出
+*/
+package metrics
+
+import (
+	"sort"
+	"strings"
+)
+
+// 指标类型
+const (
+	CounterType   = "counter"
+	GaugeType     = "gauge"
+	HistogramType = "histogram"
+	SummaryType   = "summary"
+	UntypedType   = "untyped"
+)
+
+// Label 指标标签
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample 指标采样值
+type Sample struct {
+	// Name 采样名称, 如 http_request_duration_seconds_bucket
+	Name string
+
+	Labels []Label
+
+	Value float64
+}
+
+// Family 同一名称的指标集合
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Collector 指标收集器, 输出时调用 Collect 获取当前指标
+type Collector interface {
+	Collect() []Family
+}
+
+// Opts 指标配置
+type Opts struct {
+	// Name 指标名称, 需满足 [a-zA-Z_:][a-zA-Z0-9_:]*, counter 建议以 _total 结尾
+	Name string
+
+	// Help 指标说明
+	Help string
+
+	// ConstLabels 固定标签, 如 service, instance
+	ConstLabels map[string]string
+}
+
+// desc 指标描述
+type desc struct {
+	name        string
+	help        string
+	typ         string
+	constLabels []Label
+}
+
+func newDesc(opts Opts, typ string) *desc {
+	d := &desc{
+		name: opts.Name,
+		help: opts.Help,
+		typ:  typ,
+	}
+	for name, value := range opts.ConstLabels {
+		d.constLabels = append(d.constLabels, Label{Name: name, Value: value})
+	}
+	sort.Slice(d.constLabels, func(i, j int) bool {
+		return d.constLabels[i].Name < d.constLabels[j].Name
+	})
+	return d
+}
+
+func (d *desc) family(samples []Sample) Family {
+	return Family{
+		Name:    d.name,
+		Help:    d.help,
+		Type:    d.typ,
+		Samples: samples,
+	}
+}
+
+// metric 单个指标序列, name 为指标名称, labels 为常量标签及向量标签
+type metric interface {
+	samples(name string, labels []Label) []Sample
+}
+
+// withLabel 复制标签并追加, 避免修改共享的标签切片
+func withLabel(labels []Label, name string, value string) []Label {
+	res := make([]Label, 0, len(labels)+1)
+	res = append(res, labels...)
+	return append(res, Label{Name: name, Value: value})
+}
+
+// CollectorFunc 将函数转换为 Collector
+type CollectorFunc func() []Family
+
+func (f CollectorFunc) Collect() []Family {
+	return f()
+}
+
+// MergeFamilies 合并同名指标并按名称排序
+func MergeFamilies(families []Family) []Family {
+	index := map[string]int{}
+	var res []Family
+	for _, family := range families {
+		if i, has := index[family.Name]; has {
+			res[i].Samples = append(res[i].Samples, family.Samples...)
+			continue
+		}
+		index[family.Name] = len(res)
+		family.Samples = append([]Sample(nil), family.Samples...)
+		res = append(res, family)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return strings.Compare(res[i].Name, res[j].Name) < 0
+	})
+	return res
+}
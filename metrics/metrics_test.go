@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistryPrometheus(t *testing.T) {
+	registry := NewRegistry()
+	requests := NewCounterVec(Opts{
+		Name:        "jobs_total",
+		Help:        "Total jobs.\nsecond line",
+		ConstLabels: map[string]string{"zone": "a", "app": "test"},
+	}, "type", "status")
+	latency := NewHistogram(HistogramOpts{
+		Opts:    Opts{Name: "job_seconds", Help: "Job latency."},
+		Buckets: []float64{1, 0.5},
+	})
+	size := NewSummary(SummaryOpts{
+		Opts:       Opts{Name: "job_size", Help: "Job size."},
+		Objectives: []float64{0.5, 1},
+	})
+	value := 0.0
+	registry.MustRegister(requests, latency, size, NewGaugeFunc(Opts{Name: "queue_size"}, func() float64 {
+		return value
+	}))
+
+	requests.WithLabelValues("email", "ok").Inc()
+	requests.With(map[string]string{"type": "a\"b\\c\nd", "status": "ok"}).Add(2.5)
+	latency.Observe(0.3)
+	latency.Observe(0.7)
+	latency.Observe(3)
+	for i := 1; i <= 5; i++ {
+		size.Observe(float64(i))
+	}
+	value = 7
+
+	buf := &bytes.Buffer{}
+	if err := registry.WritePrometheus(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP job_seconds Job latency.
+# TYPE job_seconds histogram
+job_seconds_bucket{le="0.5"} 1
+job_seconds_bucket{le="1"} 2
+job_seconds_bucket{le="+Inf"} 3
+job_seconds_sum 4
+job_seconds_count 3
+# HELP job_size Job size.
+# TYPE job_size summary
+job_size{quantile="0.5"} 3
+job_size{quantile="1"} 5
+job_size_sum 15
+job_size_count 5
+# HELP jobs_total Total jobs.\nsecond line
+# TYPE jobs_total counter
+jobs_total{app="test",zone="a",type="a\"b\\c\nd",status="ok"} 2.5
+jobs_total{app="test",zone="a",type="email",status="ok"} 1
+# TYPE queue_size gauge
+queue_size 7
+`
+	if buf.String() != expected {
+		t.Fatalf("prometheus output error:\n%v", buf.String())
+	}
+
+	buf.Reset()
+	if err := registry.WriteOpenMetrics(buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	if !strings.Contains(text, "# TYPE jobs counter\n") || !strings.Contains(text, `jobs_total{app="test",zone="a",type="email",status="ok"} 1`) ||
+		!strings.HasSuffix(text, "# EOF\n") {
+		t.Fatalf("openmetrics output error:\n%v", text)
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.Register(NewCounter(Opts{Name: "bad-name"})); err == nil {
+		t.Fatal("invalid name should fail")
+	}
+	if err := registry.Register(NewCounter(Opts{Name: "same"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(NewGauge(Opts{Name: "same"})); err == nil {
+		t.Fatal("type conflict should fail")
+	}
+	gauges := NewGaugeVec(Opts{Name: "temperature"}, "room")
+	gauges.WithLabelValues("a").Set(1)
+	gauges.WithLabelValues("b").Set(2)
+	if !gauges.Delete("a") || len(gauges.Collect()[0].Samples) != 1 {
+		t.Fatal("vec delete error")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("wrong label count should panic")
+		}
+	}()
+	gauges.WithLabelValues("a", "b")
+}
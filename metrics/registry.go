@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// PrometheusContentType Prometheus 文本格式
+	PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	// OpenMetricsContentType OpenMetrics 文本格式
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+var metricNameReg = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+var labelNameReg = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Registry 指标注册表, 自身也是 Collector, 可注册到其他注册表中
+type Registry struct {
+	collectors []Collector
+	sync.RWMutex
+}
+
+// NewRegistry 创建注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// DefaultRegistry 默认注册表
+var DefaultRegistry = NewRegistry()
+
+// Register 注册收集器, 指标名称或标签名称不合法, 或与已注册的指标名称及类型冲突时返回 error
+func (r *Registry) Register(collector Collector) error {
+	if collector == nil {
+		return errors.New("collector 不能为空")
+	}
+	families := collector.Collect()
+	for _, family := range families {
+		if err := validateFamily(family); err != nil {
+			return err
+		}
+	}
+	existed := map[string]string{}
+	for _, family := range r.Collect() {
+		existed[family.Name] = family.Type
+	}
+	for _, family := range families {
+		if typ, has := existed[family.Name]; has && typ != family.Type {
+			return errors.New(fmt.Sprintf("指标 %s 类型冲突: %s, %s", family.Name, typ, family.Type))
+		}
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.collectors = append(r.collectors, collector)
+	return nil
+}
+
+// MustRegister 注册收集器, 出错时 panic
+func (r *Registry) MustRegister(collectors ...Collector) {
+	for _, collector := range collectors {
+		if err := r.Register(collector); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Collect 收集所有指标, 同名指标合并, 按名称排序
+func (r *Registry) Collect() []Family {
+	r.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.RUnlock()
+	var families []Family
+	for _, collector := range collectors {
+		families = append(families, collector.Collect()...)
+	}
+	return MergeFamilies(families)
+}
+
+// WritePrometheus 输出 Prometheus 文本格式
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	return WritePrometheus(w, r.Collect())
+}
+
+// WriteOpenMetrics 输出 OpenMetrics 文本格式
+func (r *Registry) WriteOpenMetrics(w io.Writer) error {
+	return WriteOpenMetrics(w, r.Collect())
+}
+
+// Register 注册收集器至默认注册表
+func Register(collector Collector) error {
+	return DefaultRegistry.Register(collector)
+}
+
+// MustRegister 注册收集器至默认注册表, 出错时 panic
+func MustRegister(collectors ...Collector) {
+	DefaultRegistry.MustRegister(collectors...)
+}
+
+func validateFamily(family Family) error {
+	if !metricNameReg.MatchString(family.Name) {
+		return errors.New(fmt.Sprintf("指标名称不合法: %s", family.Name))
+	}
+	for _, sample := range family.Samples {
+		for _, label := range sample.Labels {
+			if !labelNameReg.MatchString(label.Name) || strings.HasPrefix(label.Name, "__") {
+				return errors.New(fmt.Sprintf("指标 %s 标签名称不合法: %s", family.Name, label.Name))
+			}
+		}
+	}
+	return nil
+}
+
+// WritePrometheus 按 Prometheus 文本格式输出指标
+func WritePrometheus(w io.Writer, families []Family) error {
+	buf := &bytes.Buffer{}
+	for _, family := range families {
+		if len(family.Help) > 0 {
+			fmt.Fprintf(buf, "# HELP %s %s\n", family.Name, escapeHelp(family.Help))
+		}
+		typ := family.Type
+		if len(typ) <= 0 {
+			typ = UntypedType
+		}
+		fmt.Fprintf(buf, "# TYPE %s %s\n", family.Name, typ)
+		for _, sample := range family.Samples {
+			writeSample(buf, sample.Name, sample)
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteOpenMetrics 按 OpenMetrics 文本格式输出指标
+//
+// counter 指标名称去除 _total 后缀, 采样名称补全 _total 后缀
+func WriteOpenMetrics(w io.Writer, families []Family) error {
+	buf := &bytes.Buffer{}
+	for _, family := range families {
+		name := family.Name
+		typ := family.Type
+		switch typ {
+		case CounterType:
+			name = strings.TrimSuffix(name, "_total")
+		case "", UntypedType:
+			typ = "unknown"
+		}
+		fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+		if len(family.Help) > 0 {
+			fmt.Fprintf(buf, "# HELP %s %s\n", name, EscapeLabelValue(family.Help))
+		}
+		for _, sample := range family.Samples {
+			sampleName := sample.Name
+			if family.Type == CounterType && sampleName == family.Name {
+				sampleName = name + "_total"
+			}
+			writeSample(buf, sampleName, sample)
+		}
+	}
+	buf.WriteString("# EOF\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeSample(buf *bytes.Buffer, name string, sample Sample) {
+	buf.WriteString(name)
+	if len(sample.Labels) > 0 {
+		buf.WriteByte('{')
+		for i, label := range sample.Labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, `%s="%s"`, label.Name, EscapeLabelValue(label.Value))
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatValue(sample.Value))
+	buf.WriteByte('\n')
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
+
+// EscapeLabelValue 转义标签值中的 \, ", 换行
+func EscapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Counter 只增计数器
+type Counter struct {
+	desc *desc
+	bits uint64
+}
+
+// NewCounter 创建计数器
+func NewCounter(opts Opts) *Counter {
+	return &Counter{desc: newDesc(opts, CounterType)}
+}
+
+// Inc 加1
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add 增加指定值, 小于0时忽略
+func (c *Counter) Add(value float64) {
+	if value < 0 {
+		return
+	}
+	addFloat(&c.bits, value)
+}
+
+// Value 当前值
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+func (c *Counter) samples(name string, labels []Label) []Sample {
+	return []Sample{{Name: name, Labels: labels, Value: c.Value()}}
+}
+
+func (c *Counter) Collect() []Family {
+	return []Family{c.desc.family(c.samples(c.desc.name, c.desc.constLabels))}
+}
+
+// Gauge 可增减的数值
+type Gauge struct {
+	desc *desc
+	bits uint64
+}
+
+// NewGauge 创建 Gauge
+func NewGauge(opts Opts) *Gauge {
+	return &Gauge{desc: newDesc(opts, GaugeType)}
+}
+
+// Set 设置值
+func (g *Gauge) Set(value float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(value))
+}
+
+// SetToCurrentTime 设置为当前 unix 时间戳, 单位: 秒
+func (g *Gauge) SetToCurrentTime() {
+	g.Set(float64(time.Now().UnixNano()) / 1e9)
+}
+
+// Inc 加1
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec 减1
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Add 增加指定值, 可为负数
+func (g *Gauge) Add(value float64) {
+	addFloat(&g.bits, value)
+}
+
+// Sub 减少指定值
+func (g *Gauge) Sub(value float64) {
+	g.Add(-value)
+}
+
+// Value 当前值
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) samples(name string, labels []Label) []Sample {
+	return []Sample{{Name: name, Labels: labels, Value: g.Value()}}
+}
+
+func (g *Gauge) Collect() []Family {
+	return []Family{g.desc.family(g.samples(g.desc.name, g.desc.constLabels))}
+}
+
+// funcMetric 基于回调的指标
+type funcMetric struct {
+	desc *desc
+	fn   func() float64
+}
+
+// NewGaugeFunc 创建基于回调的 Gauge, 每次输出时调用 fn 获取当前值
+func NewGaugeFunc(opts Opts, fn func() float64) Collector {
+	return &funcMetric{desc: newDesc(opts, GaugeType), fn: fn}
+}
+
+// NewCounterFunc 创建基于回调的 Counter, fn 返回值需只增
+func NewCounterFunc(opts Opts, fn func() float64) Collector {
+	return &funcMetric{desc: newDesc(opts, CounterType), fn: fn}
+}
+
+func (f *funcMetric) Collect() []Family {
+	return []Family{f.desc.family([]Sample{{Name: f.desc.name, Labels: f.desc.constLabels, Value: f.fn()}})}
+}
+
+func addFloat(bits *uint64, delta float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		value := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(bits, old, value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// vec 按标签值区分的指标集合
+type vec struct {
+	desc       *desc
+	labelNames []string
+	newMetric  func() metric
+	children   map[string]*vecChild
+	sync.RWMutex
+}
+
+type vecChild struct {
+	values []string
+	metric metric
+}
+
+func newVec(d *desc, labelNames []string, newMetric func() metric) *vec {
+	return &vec{
+		desc:       d,
+		labelNames: append([]string(nil), labelNames...),
+		newMetric:  newMetric,
+		children:   map[string]*vecChild{},
+	}
+}
+
+func vecKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// get 获取标签值对应的指标, 不存在则创建, 标签数量不一致时 panic
+func (v *vec) get(values []string) metric {
+	if len(values) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics %s 标签数量错误, 需要: %v, 实际: %v", v.desc.name, v.labelNames, values))
+	}
+	key := vecKey(values)
+	v.RLock()
+	child, has := v.children[key]
+	v.RUnlock()
+	if has {
+		return child.metric
+	}
+	v.Lock()
+	defer v.Unlock()
+	if child, has = v.children[key]; !has {
+		child = &vecChild{
+			values: append([]string(nil), values...),
+			metric: v.newMetric(),
+		}
+		v.children[key] = child
+	}
+	return child.metric
+}
+
+func (v *vec) getWith(labels map[string]string) metric {
+	values := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		value, has := labels[name]
+		if !has {
+			panic(fmt.Sprintf("metrics %s 缺少标签: %s", v.desc.name, name))
+		}
+		values[i] = value
+	}
+	if len(labels) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics %s 标签数量错误, 需要: %v, 实际: %v", v.desc.name, v.labelNames, labels))
+	}
+	return v.get(values)
+}
+
+// Delete 删除标签值对应的指标
+func (v *vec) Delete(values ...string) bool {
+	v.Lock()
+	defer v.Unlock()
+	key := vecKey(values)
+	_, has := v.children[key]
+	delete(v.children, key)
+	return has
+}
+
+// Reset 删除所有指标
+func (v *vec) Reset() {
+	v.Lock()
+	defer v.Unlock()
+	v.children = map[string]*vecChild{}
+}
+
+func (v *vec) Collect() []Family {
+	v.RLock()
+	children := make([]*vecChild, 0, len(v.children))
+	for _, child := range v.children {
+		children = append(children, child)
+	}
+	v.RUnlock()
+	sort.Slice(children, func(i, j int) bool {
+		return vecKey(children[i].values) < vecKey(children[j].values)
+	})
+	var samples []Sample
+	for _, child := range children {
+		labels := make([]Label, 0, len(v.desc.constLabels)+len(v.labelNames))
+		labels = append(labels, v.desc.constLabels...)
+		for i, name := range v.labelNames {
+			labels = append(labels, Label{Name: name, Value: child.values[i]})
+		}
+		samples = append(samples, child.metric.samples(v.desc.name, labels)...)
+	}
+	return []Family{v.desc.family(samples)}
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec 创建带标签的计数器, labelNames 为标签名称
+func NewCounterVec(opts Opts, labelNames ...string) *CounterVec {
+	return &CounterVec{newVec(newDesc(opts, CounterType), labelNames, func() metric {
+		return &Counter{}
+	})}
+}
+
+// WithLabelValues 按标签值获取计数器, 值的顺序与 labelNames 一致
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.get(values).(*Counter)
+}
+
+// With 按标签获取计数器
+func (v *CounterVec) With(labels map[string]string) *Counter {
+	return v.getWith(labels).(*Counter)
+}
+
+// GaugeVec 带标签的 Gauge
+type GaugeVec struct {
+	*vec
+}
+
+// NewGaugeVec 创建带标签的 Gauge
+func NewGaugeVec(opts Opts, labelNames ...string) *GaugeVec {
+	return &GaugeVec{newVec(newDesc(opts, GaugeType), labelNames, func() metric {
+		return &Gauge{}
+	})}
+}
+
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.get(values).(*Gauge)
+}
+
+func (v *GaugeVec) With(labels map[string]string) *Gauge {
+	return v.getWith(labels).(*Gauge)
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	*vec
+}
+
+// NewHistogramVec 创建带标签的直方图
+func NewHistogramVec(opts HistogramOpts, labelNames ...string) *HistogramVec {
+	buckets := normalizeBuckets(opts.Buckets)
+	return &HistogramVec{newVec(newDesc(opts.Opts, HistogramType), labelNames, func() metric {
+		return newHistogram(nil, buckets)
+	})}
+}
+
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.get(values).(*Histogram)
+}
+
+func (v *HistogramVec) With(labels map[string]string) *Histogram {
+	return v.getWith(labels).(*Histogram)
+}
+
+// SummaryVec 带标签的摘要
+type SummaryVec struct {
+	*vec
+}
+
+// NewSummaryVec 创建带标签的摘要
+func NewSummaryVec(opts SummaryOpts, labelNames ...string) *SummaryVec {
+	return &SummaryVec{newVec(newDesc(opts.Opts, SummaryType), labelNames, func() metric {
+		return newSummary(nil, opts)
+	})}
+}
+
+func (v *SummaryVec) WithLabelValues(values ...string) *Summary {
+	return v.get(values).(*Summary)
+}
+
+func (v *SummaryVec) With(labels map[string]string) *Summary {
+	return v.getWith(labels).(*Summary)
+}
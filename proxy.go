@@ -0,0 +1,559 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wenlaizhou/middleware/metrics"
+)
+
+// 负载均衡策略
+const (
+	ProxyRoundRobin = "round_robin"
+	ProxyLeastConn  = "least_conn"
+)
+
+// 转发请求头
+const (
+	XForwardedFor    = "X-Forwarded-For"
+	XForwardedHost   = "X-Forwarded-Host"
+	XForwardedProto  = "X-Forwarded-Proto"
+	XForwardedPrefix = "X-Forwarded-Prefix"
+)
+
+// ErrNoHealthyUpstream 没有可用的上游服务
+var ErrNoHealthyUpstream = errors.New("没有可用的上游服务")
+
+// ProxyHealthCheck 上游服务主动健康检查配置
+type ProxyHealthCheck struct {
+	// Path 健康检查路径, 如 /health, 为空则不进行主动健康检查, 返回 2xx 或 3xx 视为健康
+	Path string
+
+	// Interval 检查间隔, 默认10秒
+	Interval time.Duration
+
+	// Timeout 单次检查超时时间, 默认2秒
+	Timeout time.Duration
+
+	// Fails 连续失败次数达到后标记为不可用, 默认1
+	Fails int
+
+	// Passes 连续成功次数达到后恢复可用, 默认1
+	Passes int
+}
+
+// ProxyConfig 反向代理配置
+type ProxyConfig struct {
+	// Name 代理名称, 用于指标 proxy 标签, RegisterProxy 时默认为路由前缀
+	Name string
+
+	// Upstreams 上游服务地址, 如 http://127.0.0.1:8080/base
+	Upstreams []string
+
+	// Balance 负载均衡策略, ProxyRoundRobin(默认) 或 ProxyLeastConn
+	Balance string
+
+	// StripPrefix 转发前从请求路径中去除的前缀, 并通过 X-Forwarded-Prefix 传递
+	StripPrefix string
+
+	// Rewrite 路径重写, 在 StripPrefix 之后执行, 结果拼接在上游地址路径之后
+	Rewrite func(path string) string
+
+	// PreserveHost 使用请求的 Host 访问上游服务
+	PreserveHost bool
+
+	// TrustForwarded 保留请求中已有的 X-Forwarded-* 请求头, 仅在前端存在可信代理时开启
+	TrustForwarded bool
+
+	// Retries 连接上游失败时的重试次数, 仅重试没有请求体的幂等请求, 每次重试选择不同的上游服务
+	Retries int
+
+	// Timeout 等待上游响应头的超时时间, 0 则不限制, 设置 Transport 时忽略
+	Timeout time.Duration
+
+	// FlushInterval 响应体刷新间隔, 负数则每次写入后立即刷新, text/event-stream 响应始终立即刷新
+	FlushInterval time.Duration
+
+	// HealthCheck 主动健康检查
+	HealthCheck ProxyHealthCheck
+
+	// Transport 访问上游服务使用的 Transport, 为空则使用默认连接池
+	Transport http.RoundTripper
+
+	// ModifyResponse 返回客户端前修改上游响应
+	ModifyResponse func(resp *http.Response) error
+}
+
+// UpstreamStatus 上游服务状态
+type UpstreamStatus struct {
+	Url     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+	Active  int64  `json:"active"`
+}
+
+type proxyUpstream struct {
+	target  *url.URL
+	name    string
+	healthy int32
+	active  int64
+	fails   int
+	passes  int
+}
+
+// ReverseProxy 反向代理, 流式转发请求及响应, 支持 websocket 升级请求
+type ReverseProxy struct {
+	conf      ProxyConfig
+	upstreams []*proxyUpstream
+	proxy     *httputil.ReverseProxy
+	transport http.RoundTripper
+	next      uint64
+	requests  *metrics.CounterVec
+	latency   *metrics.HistogramVec
+	retries   *metrics.CounterVec
+	healthy   *metrics.GaugeVec
+	active    *metrics.GaugeVec
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// defaultProxyTransport 反向代理默认使用的连接池
+var defaultProxyTransport = newProxyTransport(0)
+
+func newProxyTransport(responseHeaderTimeout time.Duration) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 64
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	return transport
+}
+
+// NewReverseProxy 创建反向代理, 配置了健康检查时启动检查协程, 不再使用时需调用 Close
+func NewReverseProxy(conf ProxyConfig) (*ReverseProxy, error) {
+	if len(conf.Upstreams) <= 0 {
+		return nil, errors.New("上游服务不能为空")
+	}
+	if len(conf.Name) <= 0 {
+		conf.Name = "default"
+	}
+	if conf.Balance != ProxyLeastConn {
+		conf.Balance = ProxyRoundRobin
+	}
+	p := &ReverseProxy{
+		conf: conf,
+		stop: make(chan struct{}),
+		requests: metrics.NewCounterVec(metrics.Opts{
+			Name: "proxy_upstream_requests_total",
+			Help: "Total number of requests sent to upstreams.",
+		}, "proxy", "upstream", "status"),
+		latency: metrics.NewHistogramVec(metrics.HistogramOpts{
+			Opts: metrics.Opts{
+				Name: "proxy_upstream_duration_seconds",
+				Help: "Upstream response header latency in seconds.",
+			},
+			Buckets: DefaultLatencyBuckets,
+		}, "proxy", "upstream"),
+		retries: metrics.NewCounterVec(metrics.Opts{
+			Name: "proxy_upstream_retries_total",
+			Help: "Total number of retried upstream requests.",
+		}, "proxy", "upstream"),
+		healthy: metrics.NewGaugeVec(metrics.Opts{
+			Name: "proxy_upstream_healthy",
+			Help: "Whether the upstream is healthy.",
+		}, "proxy", "upstream"),
+		active: metrics.NewGaugeVec(metrics.Opts{
+			Name: "proxy_upstream_active_requests",
+			Help: "Number of requests currently being served by the upstream.",
+		}, "proxy", "upstream"),
+	}
+	for _, upstream := range conf.Upstreams {
+		target, err := url.Parse(upstream)
+		if err != nil {
+			return nil, err
+		}
+		if len(target.Scheme) <= 0 || len(target.Host) <= 0 {
+			return nil, errors.New(fmt.Sprintf("上游服务地址错误: %s", upstream))
+		}
+		p.upstreams = append(p.upstreams, &proxyUpstream{
+			target:  target,
+			name:    target.Scheme + "://" + target.Host,
+			healthy: 1,
+		})
+	}
+	p.transport = conf.Transport
+	if p.transport == nil {
+		p.transport = defaultProxyTransport
+		if conf.Timeout > 0 {
+			p.transport = newProxyTransport(conf.Timeout)
+		}
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Director:       p.director,
+		Transport:      roundTripperFunc(p.roundTrip),
+		FlushInterval:  conf.FlushInterval,
+		ModifyResponse: conf.ModifyResponse,
+		ErrorHandler:   proxyErrorHandler,
+	}
+	if len(conf.HealthCheck.Path) > 0 {
+		go p.healthCheck()
+	}
+	return p, nil
+}
+
+// Serve 转发请求
+func (p *ReverseProxy) Serve(ctx Context) {
+	if !ctx.writeable {
+		mLogger.Error("禁止重复写入response")
+		return
+	}
+	ctx.writeable = false
+	start := time.Now()
+	p.proxy.ServeHTTP(ctx.Response, ctx.Request)
+	ctx.SetUpstreamTime(time.Since(start))
+}
+
+// Close 停止健康检查
+func (p *ReverseProxy) Close() {
+	p.closeOnce.Do(func() {
+		close(p.stop)
+	})
+}
+
+// Upstreams 上游服务状态
+func (p *ReverseProxy) Upstreams() []UpstreamStatus {
+	var res []UpstreamStatus
+	for _, upstream := range p.upstreams {
+		res = append(res, UpstreamStatus{
+			Url:     upstream.target.String(),
+			Healthy: atomic.LoadInt32(&upstream.healthy) == 1,
+			Active:  atomic.LoadInt64(&upstream.active),
+		})
+	}
+	return res
+}
+
+// Collect 上游服务指标, 可注册至 metrics.Registry
+func (p *ReverseProxy) Collect() []metrics.Family {
+	for _, upstream := range p.upstreams {
+		p.healthy.WithLabelValues(p.conf.Name, upstream.name).Set(float64(atomic.LoadInt32(&upstream.healthy)))
+		p.active.WithLabelValues(p.conf.Name, upstream.name).Set(float64(atomic.LoadInt64(&upstream.active)))
+	}
+	var families []metrics.Family
+	for _, collector := range []metrics.Collector{p.requests, p.latency, p.retries, p.healthy, p.active} {
+		families = append(families, collector.Collect()...)
+	}
+	return families
+}
+
+// director 重写请求路径及转发请求头, 上游服务在 roundTrip 中选择
+func (p *ReverseProxy) director(req *http.Request) {
+	urlPath := req.URL.Path
+	if len(p.conf.StripPrefix) > 0 && strings.HasPrefix(urlPath, p.conf.StripPrefix) {
+		urlPath = strings.TrimPrefix(urlPath, p.conf.StripPrefix)
+		if !strings.HasPrefix(urlPath, "/") {
+			urlPath = "/" + urlPath
+		}
+		req.Header.Set(XForwardedPrefix, strings.TrimSuffix(p.conf.StripPrefix, "/"))
+	}
+	if p.conf.Rewrite != nil {
+		urlPath = p.conf.Rewrite(urlPath)
+	}
+	req.URL.Path = urlPath
+	req.URL.RawPath = ""
+	setForwardedHeaders(req, p.conf.TrustForwarded)
+}
+
+// setForwardedHeaders 设置 X-Forwarded-* 及链路追踪请求头, X-Forwarded-For 由 httputil.ReverseProxy 追加
+func setForwardedHeaders(req *http.Request, trust bool) {
+	if !trust {
+		req.Header.Del(XForwardedFor)
+		req.Header.Del(XForwardedHost)
+		req.Header.Del(XForwardedProto)
+	}
+	if len(req.Header.Get(XForwardedHost)) <= 0 {
+		req.Header.Set(XForwardedHost, req.Host)
+	}
+	if len(req.Header.Get(XForwardedProto)) <= 0 {
+		proto := "http"
+		if req.TLS != nil {
+			proto = "https"
+		}
+		req.Header.Set(XForwardedProto, proto)
+	}
+	if trace, ok := TraceFromContext(req.Context()); ok {
+		for k, v := range trace.Headers() {
+			req.Header.Set(k, v)
+		}
+	}
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// 避免使用 go 默认的 User-Agent
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// roundTrip 选择上游服务并发送请求, 连接失败时对没有请求体的幂等请求进行重试
+func (p *ReverseProxy) roundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if p.conf.Retries > 0 && isIdempotent(req.Method) && (req.Body == nil || req.Body == http.NoBody) {
+		attempts += p.conf.Retries
+	}
+	tried := map[*proxyUpstream]bool{}
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		upstream := p.pick(tried)
+		if upstream == nil {
+			if lastErr == nil {
+				lastErr = ErrNoHealthyUpstream
+			}
+			break
+		}
+		tried[upstream] = true
+		if i > 0 {
+			p.retries.WithLabelValues(p.conf.Name, upstream.name).Inc()
+		}
+		outreq := req.Clone(req.Context())
+		outreq.URL.Scheme = upstream.target.Scheme
+		outreq.URL.Host = upstream.target.Host
+		outreq.URL.Path = singleJoiningSlash(upstream.target.Path, req.URL.Path)
+		if len(upstream.target.RawQuery) > 0 {
+			if len(outreq.URL.RawQuery) > 0 {
+				outreq.URL.RawQuery = upstream.target.RawQuery + "&" + outreq.URL.RawQuery
+			} else {
+				outreq.URL.RawQuery = upstream.target.RawQuery
+			}
+		}
+		if !p.conf.PreserveHost {
+			outreq.Host = ""
+		}
+		start := time.Now()
+		atomic.AddInt64(&upstream.active, 1)
+		resp, err := p.transport.RoundTrip(outreq)
+		p.latency.WithLabelValues(p.conf.Name, upstream.name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			atomic.AddInt64(&upstream.active, -1)
+			p.requests.WithLabelValues(p.conf.Name, upstream.name, "error").Inc()
+			mLogger.WarnF("proxy upstream error: %s %s, %v", upstream.name, req.URL.Path, err)
+			lastErr = err
+			if req.Context().Err() != nil {
+				break
+			}
+			continue
+		}
+		p.requests.WithLabelValues(p.conf.Name, upstream.name, fmt.Sprintf("%dxx", resp.StatusCode/100)).Inc()
+		resp.Body = upstreamBody(resp.Body, func() {
+			atomic.AddInt64(&upstream.active, -1)
+		})
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// pick 选择可用且未尝试过的上游服务
+func (p *ReverseProxy) pick(tried map[*proxyUpstream]bool) *proxyUpstream {
+	n := len(p.upstreams)
+	start := int((atomic.AddUint64(&p.next, 1) - 1) % uint64(n))
+	var best *proxyUpstream
+	for i := 0; i < n; i++ {
+		upstream := p.upstreams[(start+i)%n]
+		if tried[upstream] || atomic.LoadInt32(&upstream.healthy) != 1 {
+			continue
+		}
+		if p.conf.Balance != ProxyLeastConn {
+			return upstream
+		}
+		if best == nil || atomic.LoadInt64(&upstream.active) < atomic.LoadInt64(&best.active) {
+			best = upstream
+		}
+	}
+	return best
+}
+
+// healthCheck 定时检查所有上游服务
+func (p *ReverseProxy) healthCheck() {
+	hc := p.conf.HealthCheck
+	if hc.Interval <= 0 {
+		hc.Interval = 10 * time.Second
+	}
+	if hc.Timeout <= 0 {
+		hc.Timeout = 2 * time.Second
+	}
+	if hc.Fails <= 0 {
+		hc.Fails = 1
+	}
+	if hc.Passes <= 0 {
+		hc.Passes = 1
+	}
+	client := &http.Client{
+		Timeout:   hc.Timeout,
+		Transport: p.transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
+	for {
+		wg := sync.WaitGroup{}
+		for _, upstream := range p.upstreams {
+			wg.Add(1)
+			go func(upstream *proxyUpstream) {
+				defer wg.Done()
+				p.check(client, hc, upstream)
+			}(upstream)
+		}
+		wg.Wait()
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *ReverseProxy) check(client *http.Client, hc ProxyHealthCheck, upstream *proxyUpstream) {
+	target := *upstream.target
+	checkPath := hc.Path
+	target.RawQuery = ""
+	if index := strings.Index(checkPath, "?"); index >= 0 {
+		target.RawQuery = checkPath[index+1:]
+		checkPath = checkPath[:index]
+	}
+	target.Path = singleJoiningSlash(target.Path, checkPath)
+	resp, err := client.Get(target.String())
+	ok := err == nil && resp.StatusCode < 400
+	if resp != nil {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+	}
+	healthy := atomic.LoadInt32(&upstream.healthy) == 1
+	if ok {
+		upstream.fails = 0
+		upstream.passes++
+		if !healthy && upstream.passes >= hc.Passes {
+			atomic.StoreInt32(&upstream.healthy, 1)
+			mLogger.InfoF("上游服务恢复可用: %s", upstream.name)
+		}
+		return
+	}
+	upstream.passes = 0
+	upstream.fails++
+	if healthy && upstream.fails >= hc.Fails {
+		atomic.StoreInt32(&upstream.healthy, 0)
+		if err == nil {
+			err = errors.New(resp.Status)
+		}
+		mLogger.WarnF("上游服务不可用: %s, %v", upstream.name, err)
+	}
+}
+
+// proxyErrorHandler 连接上游失败时返回 502, 超时返回 504, 没有可用上游服务时返回 503
+func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	code := StatusBadGateway
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrNoHealthyUpstream):
+		code = StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		code = StatusGatewayTimeout
+	}
+	mLogger.ErrorF("proxy error: %s %s, %v", r.Method, r.URL.Path, err)
+	w.Header().Set(ContentType, Plain)
+	w.WriteHeader(code)
+	_, _ = w.Write([]byte(http.StatusText(code)))
+}
+
+// upstreamBody 响应体关闭时执行 done, websocket 升级响应的响应体需保留 Write 方法
+func upstreamBody(body io.ReadCloser, done func()) io.ReadCloser {
+	b := &trackedBody{ReadCloser: body, done: done}
+	if rw, ok := body.(io.ReadWriteCloser); ok {
+		return &trackedConn{trackedBody: b, writer: rw}
+	}
+	return b
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	done func()
+	once sync.Once
+}
+
+func (b *trackedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+type trackedConn struct {
+	*trackedBody
+	writer io.Writer
+}
+
+func (c *trackedConn) Write(p []byte) (int, error) {
+	return c.writer.Write(p)
+}
+
+func isIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case GET, HEAD, OPTIONS, PUT, DELETE, "TRACE":
+		return true
+	}
+	return false
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// RegisterProxy 注册反向代理, prefix 下的请求转发至上游服务, 上游指标注册至 Server.Metrics,
+// Server 关闭时停止健康检查
+//
+//	srv.RegisterProxy("/api/", ProxyConfig{
+//		Upstreams:   []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+//		StripPrefix: "/api",
+//		Retries:     1,
+//		HealthCheck: ProxyHealthCheck{Path: "/health"},
+//	})
+func (t *Server) RegisterProxy(prefix string, conf ProxyConfig) (*ReverseProxy, error) {
+	if len(conf.Name) <= 0 {
+		conf.Name = prefix
+	}
+	p, err := NewReverseProxy(conf)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.registry.Register(p); err != nil {
+		p.Close()
+		return nil, err
+	}
+	t.RegisterHandler(prefix, p.Serve)
+	t.RegisterShutdownHook(p.Close)
+	return p, nil
+}
+
+// RegisterProxy 在全局Server注册反向代理
+func RegisterProxy(prefix string, conf ProxyConfig) (*ReverseProxy, error) {
+	return globalServer.RegisterProxy(prefix, conf)
+}
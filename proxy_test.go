@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func upstreamServer(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(StatusOK)
+			return
+		}
+		w.Header().Add("X-Multi", "a")
+		w.Header().Add("X-Multi", "b")
+		_, _ = fmt.Fprintf(w, "%s %s?%s host=%s proto=%s prefix=%s conn=%s", name, r.URL.Path, r.URL.RawQuery,
+			r.Header.Get(XForwardedHost), r.Header.Get(XForwardedProto), r.Header.Get(XForwardedPrefix), r.Header.Get("X-Hop"))
+	}))
+}
+
+func proxyGet(srv *Server, method string, target string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Connection", "X-Hop")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set(XForwardedHost, "spoofed")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	return w
+}
+
+func TestReverseProxyBalance(t *testing.T) {
+	a, b := upstreamServer("a"), upstreamServer("b")
+	defer a.Close()
+	defer b.Close()
+	srv := NewServer("", 0)
+	proxy, err := srv.RegisterProxy("/api/", ProxyConfig{
+		Upstreams:   []string{a.URL + "/base", b.URL + "/base"},
+		StripPrefix: "/api",
+		Rewrite: func(path string) string {
+			return strings.Replace(path, "/v1/", "/v2/", 1)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i := 0; i < 4; i++ {
+		w := proxyGet(srv, GET, "/api/v1/users?id=1", "")
+		body := w.Body.String()
+		if w.Code != StatusOK || !strings.HasSuffix(body, " /base/v2/users?id=1 host=example.com proto=http prefix=/api conn=") ||
+			strings.Join(w.Header().Values("X-Multi"), ",") != "a,b" {
+			t.Fatalf("proxy response error: %v %v %v", w.Code, body, w.Header())
+		}
+		names = append(names, body[:1])
+	}
+	if strings.Join(names, "") != "abab" {
+		t.Fatalf("round robin error: %v", names)
+	}
+	found := false
+	for _, family := range proxy.Collect() {
+		if family.Name == "proxy_upstream_requests_total" && len(family.Samples) == 2 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("proxy metrics error: %v", proxy.Collect())
+	}
+}
+
+func TestReverseProxyRetryAndHealth(t *testing.T) {
+	healthy := upstreamServer("ok")
+	defer healthy.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	srv := NewServer("", 0)
+	_, err := srv.RegisterProxy("/", ProxyConfig{
+		Upstreams: []string{down.URL, healthy.URL},
+		Retries:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if w := proxyGet(srv, GET, "/x", ""); w.Code != StatusOK || !strings.HasPrefix(w.Body.String(), "ok /x") {
+			t.Fatalf("retry error: %v %v", w.Code, w.Body.String())
+		}
+	}
+	codes := map[int]int{}
+	for i := 0; i < 2; i++ {
+		codes[proxyGet(srv, POST, "/x", "body").Code]++
+	}
+	if codes[StatusBadGateway] != 1 || codes[StatusOK] != 1 {
+		t.Fatalf("non idempotent request retried: %v", codes)
+	}
+
+	proxy, err := NewReverseProxy(ProxyConfig{
+		Upstreams:   []string{down.URL, healthy.URL},
+		HealthCheck: ProxyHealthCheck{Path: "/health", Interval: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	for i := 0; i < 100 && proxy.Upstreams()[0].Healthy; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := proxy.Upstreams(); status[0].Healthy || !status[1].Healthy {
+		t.Fatalf("health check error: %v", status)
+	}
+	srv = NewServer("", 0)
+	srv.RegisterHandler("/", proxy.Serve)
+	for i := 0; i < 3; i++ {
+		if w := proxyGet(srv, POST, "/x", "body"); w.Code != StatusOK {
+			t.Fatalf("unhealthy upstream used: %v", w.Code)
+		}
+	}
+
+	none, _ := NewReverseProxy(ProxyConfig{Upstreams: []string{down.URL}})
+	srv.RegisterHandler("/none/", none.Serve)
+	if w := proxyGet(srv, GET, "/none/x", ""); w.Code != StatusBadGateway || w.Header().Get("server") == "framework" {
+		t.Fatalf("proxy error response error: %v %v", w.Code, w.Header())
+	}
+}
+
+func TestReverseProxyLeastConn(t *testing.T) {
+	proxy, _ := NewReverseProxy(ProxyConfig{
+		Upstreams: []string{"http://a", "http://b", "http://c"},
+		Balance:   ProxyLeastConn,
+	})
+	proxy.upstreams[0].active = 3
+	proxy.upstreams[1].active = 1
+	proxy.upstreams[2].active = 2
+	for i := 0; i < 3; i++ {
+		if upstream := proxy.pick(map[*proxyUpstream]bool{}); upstream != proxy.upstreams[1] {
+			t.Fatalf("least conn error: %v", upstream.name)
+		}
+	}
+	if upstream := proxy.pick(map[*proxyUpstream]bool{proxy.upstreams[1]: true}); upstream != proxy.upstreams[2] {
+		t.Fatalf("least conn exclude error: %v", upstream.name)
+	}
+}
+
+func TestReverseProxyStreaming(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ContentType, EventStream)
+		_, _ = w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte("data: second\n\n"))
+	}))
+	defer upstream.Close()
+	defer close(release)
+	srv := NewServer("", 0)
+	if _, err := srv.RegisterProxy("/", ProxyConfig{Upstreams: []string{upstream.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "data: first\n" {
+		t.Fatalf("streaming error: %q %v", line, err)
+	}
+}
+
+func TestReverseProxyWebsocket(t *testing.T) {
+	backend := NewServer("", 0)
+	backend.RegisterWebsocketWithConfig("/ws", WebsocketConfig{AllowOrigins: []string{"*"}}, func(conn *WebsocketConn) {
+		for {
+			_, data, err := conn.Read()
+			if err != nil {
+				return
+			}
+			_ = conn.SendText("echo:" + string(data))
+		}
+	})
+	upstream := httptest.NewServer(backend)
+	defer upstream.Close()
+	srv := NewServer("", 0)
+	if _, err := srv.RegisterProxy("/", ProxyConfig{Upstreams: []string{upstream.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	conn := dialWebsocket(t, server.URL+"/ws", nil)
+	defer conn.Close()
+	_ = conn.WriteMessage(websocket.TextMessage, []byte("hi"))
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "echo:hi" {
+		t.Fatalf("websocket proxy error: %q %v", data, err)
+	}
+}
+
+func TestProxyPass(t *testing.T) {
+	upstream := upstreamServer("pass")
+	defer upstream.Close()
+	srv := NewServer("", 0)
+	srv.RegisterHandler("/pass", func(c Context) {
+		c.ProxyPass(upstream.URL+"/target", 5)
+	})
+	w := proxyGet(srv, GET, "/pass?a=1&b=2", "")
+	body, _ := ioutil.ReadAll(w.Body)
+	if w.Code != StatusOK || string(body) != "pass /target?a=1&b=2 host=example.com proto=http prefix= conn=" ||
+		len(w.Header().Values("X-Multi")) != 2 || w.Header().Get("server") == "framework" {
+		t.Fatalf("proxy pass error: %v %v %v", w.Code, string(body), w.Header())
+	}
+}
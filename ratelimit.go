@@ -0,0 +1,365 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wenlaizhou/middleware/metrics"
+)
+
+// RateLimitResult 限流判断结果
+type RateLimitResult struct {
+	// Allowed 是否允许本次请求
+	Allowed bool
+
+	// Limit 窗口内允许的最大请求数
+	Limit int
+
+	// Remaining 窗口内剩余请求数
+	Remaining int
+
+	// Reset 额度完全恢复的剩余时间
+	Reset time.Duration
+
+	// RetryAfter 被拒绝时, 距下次可请求的时间
+	RetryAfter time.Duration
+}
+
+// RateLimiter 限流器, 默认实现为内存存储, 可实现该接口接入 redis 等共享存储
+type RateLimiter interface {
+	// Allow 消耗 key 对应的一次请求额度
+	Allow(key string) RateLimitResult
+}
+
+// RateLimitKeyFunc 获取限流 key, 返回空字符串则不限流
+type RateLimitKeyFunc func(ctx *Context) string
+
+// rateLimitSweepInterval 内存限流器清理过期 key 的间隔
+const rateLimitSweepInterval = time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucketLimiter 令牌桶限流器, 允许突发请求
+type TokenBucketLimiter struct {
+	rate      float64
+	burst     int
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	sync.Mutex
+}
+
+// NewTokenBucketLimiter 创建令牌桶限流器
+//
+// rate: 每秒生成的令牌数, burst: 桶容量, 即允许的最大突发请求数
+func NewTokenBucketLimiter(rate float64, burst int) *TokenBucketLimiter {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &TokenBucketLimiter{
+		rate:      rate,
+		burst:     burst,
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *TokenBucketLimiter) Allow(key string) RateLimitResult {
+	now := time.Now()
+	l.Lock()
+	defer l.Unlock()
+	l.sweep(now)
+	bucket, has := l.buckets[key]
+	if !has {
+		bucket = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(l.burst), bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	res := RateLimitResult{Limit: l.burst}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.duration(1 - bucket.tokens)
+	}
+	res.Remaining = int(bucket.tokens)
+	res.Reset = l.duration(float64(l.burst) - bucket.tokens)
+	return res
+}
+
+// duration 生成指定数量令牌所需时间
+func (l *TokenBucketLimiter) duration(tokens float64) time.Duration {
+	if l.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep 清理已装满的令牌桶
+func (l *TokenBucketLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+type slidingWindow struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+// SlidingWindowLimiter 滑动窗口限流器, 按上一窗口请求数加权估算当前窗口请求数
+type SlidingWindowLimiter struct {
+	limit     int
+	window    time.Duration
+	windows   map[string]*slidingWindow
+	lastSweep time.Time
+	sync.Mutex
+}
+
+// NewSlidingWindowLimiter 创建滑动窗口限流器
+//
+// limit: 窗口内允许的最大请求数, window: 窗口时长
+func NewSlidingWindowLimiter(limit int, window time.Duration) *SlidingWindowLimiter {
+	if window <= 0 {
+		window = time.Second
+	}
+	return &SlidingWindowLimiter{
+		limit:     limit,
+		window:    window,
+		windows:   map[string]*slidingWindow{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *SlidingWindowLimiter) Allow(key string) RateLimitResult {
+	now := time.Now()
+	l.Lock()
+	defer l.Unlock()
+	l.sweep(now)
+	w, has := l.windows[key]
+	if !has {
+		w = &slidingWindow{start: now.Truncate(l.window)}
+		l.windows[key] = w
+	}
+	if elapsed := now.Sub(w.start); elapsed >= l.window {
+		w.previous = 0
+		if elapsed < 2*l.window {
+			w.previous = w.current
+		}
+		w.current = 0
+		w.start = now.Truncate(l.window)
+	}
+	reset := w.start.Add(l.window).Sub(now)
+	weight := float64(reset) / float64(l.window)
+	count := float64(w.previous)*weight + float64(w.current)
+	res := RateLimitResult{Limit: l.limit, Reset: reset}
+	if count+1 <= float64(l.limit) {
+		w.current++
+		res.Allowed = true
+		count++
+	} else {
+		res.RetryAfter = reset
+	}
+	res.Remaining = int(math.Max(0, float64(l.limit)-count))
+	return res
+}
+
+// sweep 清理两个窗口内无请求的 key
+func (l *SlidingWindowLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= 2*l.window {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// RateLimitByIp 按连接的对端ip限流, 不读取客户端可伪造的 X-Forwarded-For, X-Real-IP
+//
+// 位于反向代理之后时使用 RateLimitByProxyIp
+func RateLimitByIp(ctx *Context) string {
+	return remoteHost(ctx.Request.RemoteAddr)
+}
+
+/*
+RateLimitByProxyIp 按客户端ip限流, 仅当对端为受信任的代理时读取 X-Forwarded-For 及 X-Real-IP
+
+trustedProxies: 受信任代理的ip或网段, 如 10.0.0.1, 10.0.0.0/8; X-Forwarded-For 从右向左跳过受信任代理, 取第一个不受信任的地址
+*/
+func RateLimitByProxyIp(trustedProxies ...string) RateLimitKeyFunc {
+	var networks []*net.IPNet
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			mLogger.ErrorF("受信任代理地址错误: %s", proxy)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	trusted := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(ctx *Context) string {
+		peer := remoteHost(ctx.Request.RemoteAddr)
+		if !trusted(peer) {
+			return peer
+		}
+		forwarded := strings.Split(ctx.Request.Header.Get(XForwardedFor), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			addr := remoteHost(strings.TrimSpace(forwarded[i]))
+			if len(addr) <= 0 {
+				continue
+			}
+			if !trusted(addr) {
+				return addr
+			}
+		}
+		if realIp := remoteHost(strings.TrimSpace(ctx.Request.Header.Get("X-Real-IP"))); len(realIp) > 0 {
+			return realIp
+		}
+		return peer
+	}
+}
+
+// remoteHost 去除地址中的端口
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// RateLimitByHeader 按请求头限流, 请求头为空则不限流
+func RateLimitByHeader(name string) RateLimitKeyFunc {
+	return func(ctx *Context) string {
+		return ctx.GetHeader(name)
+	}
+}
+
+// RateLimitByApiKey 按 api key 限流, 依次读取请求头及query参数, 均为空则不限流
+func RateLimitByApiKey(header string, query string) RateLimitKeyFunc {
+	return func(ctx *Context) string {
+		if key := ctx.GetHeader(header); len(key) > 0 {
+			return key
+		}
+		if len(query) > 0 {
+			return ctx.GetQueryParam(query)
+		}
+		return ""
+	}
+}
+
+/*
+RateLimit 限流中间件
+
+超出限制返回429及 Retry-After 头, 所有请求返回 RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset 头
+
+keyFunc: 为空则按客户端ip限流, 作为 Server 或分组中间件时各路由共享额度, 需按路由限流可作为路由中间件注册
+*/
+func RateLimit(limiter RateLimiter, keyFunc RateLimitKeyFunc) Middleware {
+	if keyFunc == nil {
+		keyFunc = RateLimitByIp
+	}
+	return func(ctx *Context, next func()) {
+		key := keyFunc(ctx)
+		if len(key) <= 0 {
+			next()
+			return
+		}
+		res := limiter.Allow(key)
+		ctx.SetHeader(RateLimitLimit, strconv.Itoa(res.Limit))
+		ctx.SetHeader(RateLimitRemaining, strconv.Itoa(res.Remaining))
+		ctx.SetHeader(RateLimitReset, strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			if ctx.limits != nil {
+				ctx.limits.rateLimitRejected.WithLabelValues(ctx.RoutePattern()).Inc()
+			}
+			ctx.SetHeader(RetryAfter, strconv.Itoa(int(math.Max(1, float64(ceilSeconds(res.RetryAfter))))))
+			ctx.Error(StatusTooManyRequests, StatusText(StatusTooManyRequests))
+			return
+		}
+		next()
+	}
+}
+
+/*
+ConcurrencyLimit 并发限制中间件, 限制每个路由同时处理中的请求数, 超出返回503
+
+max: 单个路由最大并发请求数, 作为路由中间件注册时即为该路由的并发数
+*/
+func ConcurrencyLimit(max int) Middleware {
+	inflight := sync.Map{}
+	return func(ctx *Context, next func()) {
+		counter, _ := inflight.LoadOrStore(ctx.RoutePattern(), new(int64))
+		count := counter.(*int64)
+		if atomic.AddInt64(count, 1) > int64(max) {
+			atomic.AddInt64(count, -1)
+			if ctx.limits != nil {
+				ctx.limits.concurrencyLimitRejected.WithLabelValues(ctx.RoutePattern()).Inc()
+			}
+			ctx.SetHeader(RetryAfter, "1")
+			ctx.Error(StatusServiceUnavailable, StatusText(StatusServiceUnavailable))
+			return
+		}
+		defer atomic.AddInt64(count, -1)
+		next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// limitMetrics 限流及并发限制拒绝次数, 每个 Server 单独统计并注册至其 Metrics()
+type limitMetrics struct {
+	rateLimitRejected        *metrics.CounterVec
+	concurrencyLimitRejected *metrics.CounterVec
+}
+
+func newLimitMetrics() *limitMetrics {
+	return &limitMetrics{
+		rateLimitRejected: metrics.NewCounterVec(metrics.Opts{
+			Name: "rate_limit_rejected_total",
+			Help: "Total number of requests rejected by rate limit.",
+		}, "route"),
+		concurrencyLimitRejected: metrics.NewCounterVec(metrics.Opts{
+			Name: "concurrency_limit_rejected_total",
+			Help: "Total number of requests rejected by concurrency limit.",
+		}, "route"),
+	}
+}
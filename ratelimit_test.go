@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	srv := NewServer("", 0)
+	srv.GET("/token", func(c Context) {
+		c.OK(Plain, []byte("ok"))
+	}, RateLimit(NewTokenBucketLimiter(1, 2), nil))
+	srv.GET("/window", func(c Context) {
+		c.OK(Plain, []byte("ok"))
+	}, RateLimit(NewSlidingWindowLimiter(2, time.Minute), RateLimitByHeader("X-Api-Key")))
+
+	for _, path := range []string{"/token", "/window"} {
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(GET, path, nil)
+			req.Header.Set("X-Api-Key", "k")
+			srv.ServeHTTP(w, req)
+			if i < 2 && w.Code != StatusOK {
+				t.Fatalf("%v %v: code %v", path, i, w.Code)
+			}
+			if i == 2 && (w.Code != StatusTooManyRequests || len(w.Header().Get(RetryAfter)) <= 0 ||
+				w.Header().Get(RateLimitLimit) != "2" || w.Header().Get(RateLimitRemaining) != "0") {
+				t.Fatalf("%v: code %v, header %v", path, w.Code, w.Header())
+			}
+		}
+	}
+
+	// 不同 key 分别计数
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(GET, "/window", nil)
+	req.Header.Set("X-Api-Key", "other")
+	srv.ServeHTTP(w, req)
+	if w.Code != StatusOK {
+		t.Fatalf("rate limit key error: %v", w.Code)
+	}
+
+	var buf bytes.Buffer
+	if err := srv.Metrics().WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "# TYPE rate_limit_rejected_total counter") ||
+		!strings.Contains(buf.String(), `rate_limit_rejected_total{route="/window"}`) {
+		t.Fatalf("rate limit metrics error: %v", buf.String())
+	}
+
+	// 拒绝次数按 Server 单独统计
+	buf.Reset()
+	if err := NewServer("", 0).Metrics().WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), `rate_limit_rejected_total{route="/window"}`) {
+		t.Fatalf("rate limit metrics shared between servers: %v", buf.String())
+	}
+}
+
+func TestRateLimitByIp(t *testing.T) {
+	req := httptest.NewRequest(GET, "/", nil)
+	req.RemoteAddr = "10.0.0.2:5000"
+	req.Header.Set(XForwardedFor, "1.1.1.1, 2.2.2.2")
+	ctx := newContext(httptest.NewRecorder(), req)
+	if key := RateLimitByIp(&ctx); key != "10.0.0.2" {
+		t.Fatalf("forwarded header should be ignored: %v", key)
+	}
+	if key := RateLimitByProxyIp("192.168.0.1")(&ctx); key != "10.0.0.2" {
+		t.Fatalf("untrusted peer should be used: %v", key)
+	}
+	if key := RateLimitByProxyIp("10.0.0.0/8", "2.2.2.2")(&ctx); key != "1.1.1.1" {
+		t.Fatalf("forwarded client ip error: %v", key)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	srv := NewServer("", 0)
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	srv.Use(ConcurrencyLimit(1))
+	srv.GET("/slow", func(c Context) {
+		entered <- struct{}{}
+		<-release
+		c.OK(Plain, []byte("ok"))
+	})
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, "/slow", nil))
+	}()
+	<-entered
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/slow", nil))
+	if w.Code != StatusServiceUnavailable {
+		t.Fatalf("concurrency limit error: %v", w.Code)
+	}
+	close(release)
+	wg.Wait()
+
+	go func() {
+		<-entered
+	}()
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/slow", nil))
+	if w.Code != StatusOK {
+		t.Fatalf("concurrency release error: %v", w.Code)
+	}
+}
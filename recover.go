@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrorRenderer 错误响应渲染
+//
+// status: http状态码, err: 错误信息, 默认渲染器不会将 err 返回给客户端
+type ErrorRenderer func(ctx Context, status int, err error)
+
+// PanicHook panic 回调, 可用于告警
+//
+// stack: panic 发生时的调用栈
+type PanicHook func(ctx Context, err interface{}, stack string)
+
+// HtmlErrorRenderer 以 StaticHtml 页面返回错误
+func HtmlErrorRenderer(ctx Context, status int, err error) {
+	text := strings.ToUpper(StatusText(status))
+	ctx.SetHeader(ContentType, Html)
+	ctx.Error(status, fmt.Sprintf(StaticHtml, text, fmt.Sprintf("<h1>%d %s</h1>", status, text)))
+}
+
+// ApiErrorRenderer 以 ApiResponse 格式返回错误
+//
+// { code : -1, message : "", data : null }
+func ApiErrorRenderer(ctx Context, status int, err error) {
+	res, _ := json.Marshal(map[string]interface{}{
+		"code":    -1,
+		"message": StatusText(status),
+		"data":    nil,
+	})
+	ctx.SetHeader(ContentType, ApplicationJson)
+	ctx.Error(status, string(res))
+}
+
+// ProblemErrorRenderer 以 RFC 7807 problem+json 格式返回错误
+func ProblemErrorRenderer(ctx Context, status int, err error) {
+	res, _ := json.Marshal(map[string]interface{}{
+		"type":     "about:blank",
+		"title":    StatusText(status),
+		"status":   status,
+		"instance": ctx.Request.URL.Path,
+	})
+	ctx.SetHeader(ContentType, ProblemJson)
+	ctx.Error(status, string(res))
+}
+
+// NegotiateErrorRenderer 默认错误渲染, 根据 Accept 头选择:
+//
+// application/problem+json: ProblemErrorRenderer
+//
+// application/json: ApiErrorRenderer
+//
+// 其他: HtmlErrorRenderer
+func NegotiateErrorRenderer(ctx Context, status int, err error) {
+	accept := ctx.GetHeader("Accept")
+	switch {
+	case strings.Contains(accept, "application/problem+json"):
+		ProblemErrorRenderer(ctx, status, err)
+	case strings.Contains(accept, "application/json"):
+		ApiErrorRenderer(ctx, status, err)
+	default:
+		HtmlErrorRenderer(ctx, status, err)
+	}
+}
+
+// SetErrorRenderer 设置请求 panic 时的错误渲染, 默认为 NegotiateErrorRenderer
+func (t *Server) SetErrorRenderer(renderer ErrorRenderer) {
+	t.Lock()
+	defer t.Unlock()
+	t.errorRenderer = renderer
+}
+
+// RegisterPanicHook 注册 panic 回调, 处理器 panic 时调用
+func (t *Server) RegisterPanicHook(hook PanicHook) {
+	if hook == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.panicHooks = append(t.panicHooks, hook)
+}
+
+// SetErrorRenderer 设置全局Server错误渲染
+func SetErrorRenderer(renderer ErrorRenderer) {
+	globalServer.SetErrorRenderer(renderer)
+}
+
+// RegisterPanicHook 注册全局Server panic 回调
+func RegisterPanicHook(hook PanicHook) {
+	globalServer.RegisterPanicHook(hook)
+}
+
+// recoverPanic 恢复请求处理中的 panic, 记录调用栈并返回500
+//
+// 需在 defer 中直接调用
+func (t *Server) recoverPanic(ctx *Context) {
+	err := recover()
+	if err == nil {
+		return
+	}
+	if err == http.ErrAbortHandler {
+		panic(err)
+	}
+	stack := StackTrace()
+	mLogger.ErrorF("panic: %v, %v %v, remote: %v, request: %v\n%s", err, ctx.GetMethod(), ctx.Request.RequestURI, ctx.RemoteAddr(), ctx.RequestId(), stack)
+	t.RLock()
+	renderer := t.errorRenderer
+	hooks := t.panicHooks
+	t.RUnlock()
+	for _, hook := range hooks {
+		runPanicHook(hook, *ctx, err, stack)
+	}
+	if renderer == nil {
+		renderer = NegotiateErrorRenderer
+	}
+	// 缓存的部分响应丢弃, 返回完整的错误页面; 未缓存且已写出响应时只记录日志
+	if !ctx.ResetResponse() && ctx.Written() {
+		mLogger.ErrorF("panic after response written, status: %v, request: %v", ctx.Status(), ctx.RequestId())
+		return
+	}
+	ctx.code = StatusInternalServerError
+	renderer(*ctx, StatusInternalServerError, errors.New(fmt.Sprintf("%v", err)))
+}
+
+func runPanicHook(hook PanicHook, ctx Context, err interface{}, stack string) {
+	defer func() {
+		if hookErr := recover(); hookErr != nil {
+			mLogger.ErrorF("panic hook error: %v", hookErr)
+		}
+	}()
+	hook(ctx, err, stack)
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	srv := NewServer("", 0)
+	var hookErr interface{}
+	srv.RegisterPanicHook(func(ctx Context, err interface{}, stack string) {
+		hookErr = err
+	})
+	srv.GET("/panic", func(Context) {
+		panic("boom")
+	})
+	srv.GET("/written", func(c Context) {
+		c.OK(Plain, []byte("partial"))
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(GET, "/panic", nil)
+	req.Header.Set("Accept", "application/problem+json")
+	srv.ServeHTTP(w, req)
+	if w.Code != StatusInternalServerError || !strings.HasPrefix(w.Header().Get(ContentType), "application/problem+json") {
+		t.Fatalf("problem response error: %v %v", w.Code, w.Header().Get(ContentType))
+	}
+	if strings.Contains(w.Body.String(), "boom") {
+		t.Fatalf("panic detail leaked: %v", w.Body.String())
+	}
+	if hookErr != "boom" {
+		t.Fatalf("panic hook not called: %v", hookErr)
+	}
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/panic", nil))
+	if w.Code != StatusInternalServerError || !strings.Contains(w.Body.String(), "500 INTERNAL SERVER ERROR") {
+		t.Fatalf("html response error: %v %v", w.Code, w.Body.String())
+	}
+
+	// 已写出的响应不再追加错误页面
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/written", nil))
+	if w.Code != StatusOK || w.Body.String() != "partial" {
+		t.Fatalf("written response error: %v %q", w.Code, w.Body.String())
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -85,15 +86,31 @@ func GetFull(timeoutSecond int, url string, headers map[string]string) (int, map
 func DoRequest(timeoutSecond int, method string, url string,
 	headers map[string]string, contentType string,
 	body []byte) (int, map[string][]string, []byte, error) {
+	return DoRequestContext(context.Background(), timeoutSecond, method, url, headers, contentType, body)
+}
+
+// DoRequestContext : 同 DoRequest, ctx 中包含追踪信息时自动添加 X-Request-Id, traceparent, tracestate 请求头
+//
+// 处理http请求时使用 Context.Ctx() 作为 ctx, 请求取消或超时后中断请求
+//
+// return : statusCode, header, body, error
+func DoRequestContext(ctx context.Context, timeoutSecond int, method string, url string,
+	headers map[string]string, contentType string,
+	body []byte) (int, map[string][]string, []byte, error) {
 
 	bodyReader := bytes.NewReader(body)
 
-	req, err := http.NewRequest(method, url, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if ProcessError(err) {
 		return -1, nil, nil, err
 	}
 
 	client := &http.Client{}
+	if trace, ok := TraceFromContext(ctx); ok {
+		for k, v := range trace.Headers() {
+			req.Header.Set(k, v)
+		}
+	}
 	if headers != nil {
 		for k, v := range headers {
 			req.Header.Set(k, v)
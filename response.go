@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// responseWriter 记录实际写入的http状态码及响应字节数
+//
+// 支持写入响应头前执行钩子, 以及缓存响应以便中间件改写响应体
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool // 已确定状态码, 缓存响应时尚未发送
+	headerSent  bool // 响应头已发送至客户端
+	beforeWrite []func(status int)
+	buffering   bool
+	buffer      bytes.Buffer
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{
+		ResponseWriter: w,
+		status:         StatusOK,
+	}
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	if !w.buffering {
+		w.sendHeader()
+	}
+}
+
+// sendHeader 执行钩子并发送响应头, 钩子按注册的相反顺序执行
+func (w *responseWriter) sendHeader() {
+	if w.headerSent {
+		return
+	}
+	w.headerSent = true
+	hooks := w.beforeWrite
+	w.beforeWrite = nil
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i](w.status)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	if w.buffering {
+		return w.buffer.Write(data)
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += int64(n)
+	return n, err
+}
+
+// flushBuffer 结束缓存, 发送缓存的响应头及响应体
+func (w *responseWriter) flushBuffer() error {
+	if !w.buffering {
+		return nil
+	}
+	w.buffering = false
+	if !w.wroteHeader {
+		return nil
+	}
+	w.sendHeader()
+	if w.buffer.Len() <= 0 {
+		return nil
+	}
+	n, err := w.ResponseWriter.Write(w.buffer.Bytes())
+	w.size += int64(n)
+	w.buffer.Reset()
+	return err
+}
+
+// Flush 支持分块及流式响应, 缓存响应时不执行
+func (w *responseWriter) Flush() {
+	if w.buffering {
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.wroteHeader {
+			w.WriteHeader(StatusOK)
+		}
+		flusher.Flush()
+	}
+}
+
+// Hijack 支持 websocket 等协议升级
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response 不支持 Hijack")
+	}
+	w.wroteHeader = true
+	w.headerSent = true
+	w.buffering = false
+	w.buffer.Reset()
+	w.status = StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Push 支持 HTTP/2 服务端推送, 不支持时返回 http.ErrNotSupported
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap 返回原始 ResponseWriter, 供 http.ResponseController 使用
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// wrappedResponseWriter 中间件包装的 ResponseWriter, 如压缩中间件,
+// 写入的状态码及数据可能暂存在包装层, 尚未写入 responseWriter
+type wrappedResponseWriter interface {
+	http.ResponseWriter
+	// wroteStatus 包装层已确定的状态码, 未写入时 written 为 false
+	wroteStatus() (status int, written bool)
+	// resetStatus ResetResponse 时清空包装层暂存的状态码及数据
+	resetStatus()
+}
+
+// wrappedWriters 沿 Unwrap 链查找 Context.Response 到 responseWriter 之间的包装层, 由外到内
+func (c *Context) wrappedWriters() []wrappedResponseWriter {
+	var res []wrappedResponseWriter
+	w := c.Response
+	for w != nil && w != http.ResponseWriter(c.writer) {
+		if wrapped, ok := w.(wrappedResponseWriter); ok {
+			res = append(res, wrapped)
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = unwrapper.Unwrap()
+	}
+	return res
+}
+
+// responseState 实际写入的http状态码及响应字节数, 未写入时使用 Context 记录的状态码
+func (c *Context) responseState() (int, int64) {
+	if w := c.writer; w != nil {
+		if w.wroteHeader {
+			return w.status, w.size
+		}
+		for _, wrapped := range c.wrappedWriters() {
+			if status, written := wrapped.wroteStatus(); written {
+				return status, w.size
+			}
+		}
+		return c.code, w.size
+	}
+	return c.code, 0
+}
+
+// BeforeWrite 注册响应头发送前执行的钩子, 用于中间件在最后时刻添加或修改响应头
+//
+// status 为即将写入的状态码, 钩子按注册的相反顺序执行, 响应头已发送时返回 false
+//
+//	srv.Use(func(c *Context, next func()) {
+//		start := time.Now()
+//		c.BeforeWrite(func(status int) {
+//			c.SetHeader("X-Response-Time", time.Since(start).String())
+//		})
+//		next()
+//	})
+func (c *Context) BeforeWrite(hook func(status int)) bool {
+	w := c.writer
+	if w == nil || hook == nil || w.headerSent {
+		return false
+	}
+	w.beforeWrite = append(w.beforeWrite, hook)
+	return true
+}
+
+// BufferResponse 缓存之后写入的响应, 请求处理结束或调用 FlushResponse 时发送
+//
+// 中间件在 next() 后可通过 BufferedBody 读取, ResetResponse 清空后重新写入响应体,
+// 缓存期间 Flush 不生效, 不适用于流式响应; 响应头已发送时返回 false
+//
+//	srv.Use(func(c *Context, next func()) {
+//		c.BufferResponse()
+//		next()
+//		body := bytes.ToUpper(c.BufferedBody())
+//		c.ResetResponse()
+//		c.OK(Plain, body)
+//	})
+func (c *Context) BufferResponse() bool {
+	w := c.writer
+	if w == nil || w.headerSent {
+		return false
+	}
+	w.buffering = true
+	return true
+}
+
+// BufferedBody 已缓存的响应体, 未缓存响应时返回 nil
+func (c *Context) BufferedBody() []byte {
+	w := c.writer
+	if w == nil || !w.buffering {
+		return nil
+	}
+	return w.buffer.Bytes()
+}
+
+// ResetResponse 清空缓存的响应体及状态码, 之后可重新写入响应, 响应头保留
+//
+// 响应头已发送时返回 false
+func (c *Context) ResetResponse() bool {
+	w := c.writer
+	if w == nil || !w.buffering || w.headerSent {
+		return false
+	}
+	for _, wrapped := range c.wrappedWriters() {
+		wrapped.resetStatus()
+	}
+	w.buffer.Reset()
+	w.wroteHeader = false
+	w.status = StatusOK
+	c.writeable = true
+	c.code = StatusOK
+	return true
+}
+
+// FlushResponse 结束缓存并发送已缓存的响应
+func (c *Context) FlushResponse() error {
+	if c.writer == nil {
+		return nil
+	}
+	return c.writer.flushBuffer()
+}
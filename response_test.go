@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriterState(t *testing.T) {
+	srv := NewServer("", 0)
+	var status int
+	var size int64
+	srv.Use(func(c *Context, next func()) {
+		next()
+		status, size = c.Status(), c.Size()
+	})
+	srv.Route(GET, "/direct", func(c *Context) {
+		c.Response.WriteHeader(StatusCreated)
+		_, _ = c.Response.Write([]byte("created"))
+		if c.Response.(http.Pusher).Push("/app.js", nil) != http.ErrNotSupported {
+			t.Errorf("push should not be supported")
+		}
+		c.Response.(http.Flusher).Flush()
+	})
+	srv.Route(GET, "/file", func(c *Context) {
+		http.ServeFile(c.Response, c.Request, "not-exists.txt")
+	})
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/direct", nil))
+	if w.Code != StatusCreated || !w.Flushed || status != StatusCreated || size != 7 {
+		t.Fatalf("direct write state error: %v %v %v %v", w.Code, w.Flushed, status, size)
+	}
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, "/file", nil))
+	if status != StatusNotFound || size <= 0 {
+		t.Fatalf("serve file state error: %v %v", status, size)
+	}
+}
+
+func TestResponseBeforeWrite(t *testing.T) {
+	srv := NewServer("", 0)
+	var order []string
+	srv.Use(func(c *Context, next func()) {
+		c.BeforeWrite(func(status int) {
+			order = append(order, "outer")
+			c.SetHeader("X-Status", strconv.Itoa(status))
+		})
+		next()
+	})
+	srv.Use(func(c *Context, next func()) {
+		c.BeforeWrite(func(int) {
+			order = append(order, "inner")
+		})
+		next()
+		if c.BeforeWrite(func(int) {}) {
+			t.Errorf("hook registered after header sent")
+		}
+	})
+	srv.Route(GET, "/hook", func(c *Context) {
+		c.Error(StatusBadRequest, "bad")
+	})
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/hook", nil))
+	if w.Header().Get("X-Status") != "400" || strings.Join(order, ",") != "inner,outer" {
+		t.Fatalf("before write hook error: %v %v", w.Header(), order)
+	}
+}
+
+func TestResponseBuffer(t *testing.T) {
+	srv := NewServer("", 0)
+	srv.Use(func(c *Context, next func()) {
+		c.BufferResponse()
+		c.BeforeWrite(func(int) {
+			c.SetHeader("X-Buffered", "true")
+		})
+		next()
+		body := bytes.ToUpper(c.BufferedBody())
+		if c.Written() && c.Status() == StatusOK {
+			c.ResetResponse()
+			c.OK(Plain, body)
+		}
+	})
+	srv.Route(GET, "/upper", func(c *Context) {
+		c.OK(Plain, []byte("hello"))
+		c.Response.(http.Flusher).Flush()
+	})
+	srv.Route(GET, "/panic", func(c *Context) {
+		_, _ = c.Response.Write([]byte("partial"))
+		panic("error")
+	})
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/upper", nil))
+	if w.Body.String() != "HELLO" || w.Header().Get("X-Buffered") != "true" || w.Flushed {
+		t.Fatalf("buffered response error: %q %v %v", w.Body.String(), w.Header(), w.Flushed)
+	}
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(GET, "/panic", nil))
+	if w.Code != StatusInternalServerError || strings.Contains(w.Body.String(), "partial") {
+		t.Fatalf("buffered panic response error: %v %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GET 注册 GET 请求处理器, HEAD 请求自动使用该处理器
+//
+// 返回该路由对应的swagger路径, 可继续添加参数描述
+func (t *Server) GET(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return t.Handle(GET, path, handler, middlewares...)
+}
+
+// POST 注册 POST 请求处理器
+func (t *Server) POST(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return t.Handle(POST, path, handler, middlewares...)
+}
+
+// PUT 注册 PUT 请求处理器
+func (t *Server) PUT(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return t.Handle(PUT, path, handler, middlewares...)
+}
+
+// PATCH 注册 PATCH 请求处理器
+func (t *Server) PATCH(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return t.Handle(PATCH, path, handler, middlewares...)
+}
+
+// DELETE 注册 DELETE 请求处理器
+func (t *Server) DELETE(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return t.Handle(DELETE, path, handler, middlewares...)
+}
+
+// Any 注册匹配所有http方法的处理器, 同 RegisterHandler
+//
+// middlewares: 路由中间件, 在全局中间件之后执行
+func (t *Server) Any(path string, handler func(Context), middlewares ...Middleware) {
+	if handler == nil {
+		return
+	}
+	t.handle("", path, withMiddlewares(WrapHandler(handler), middlewares))
+}
+
+// Handle 注册指定http方法的处理器
+//
+// 同一路径可按http方法注册不同处理器, 未注册的方法返回405及 Allow 头
+//
+// middlewares: 路由中间件, 在全局中间件之后执行
+//
+// 返回该路由对应的swagger路径, 可继续添加参数描述
+func (t *Server) Handle(method string, path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return t.Route(method, path, WrapHandler(handler), middlewares...)
+}
+
+// Route 注册以指针接收 Context 的处理器, method 为空则匹配所有http方法
+//
+// 过滤器及中间件中通过 Set 设置的属性, 修改的状态对处理器可见
+//
+//	srv.Route(GET, "/user/{id}", func(c *Context) {
+//		c.OK(Plain, []byte(c.GetString("tenant")))
+//	})
+func (t *Server) Route(method string, path string, handler HandlerFunc, middlewares ...Middleware) *SwaggerPath {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	var swaggerPath *SwaggerPath
+	if handler != nil {
+		swaggerPath = t.handle(method, path, withMiddlewares(handler, middlewares))
+	}
+	if swaggerPath == nil {
+		// 保证链式调用可用
+		return SwaggerBuildPath(path, "", strings.ToLower(method), "")
+	}
+	return swaggerPath
+}
+
+func (t *Server) handle(method string, path string, handler HandlerFunc) *SwaggerPath {
+	if len(path) <= 0 {
+		return nil
+	}
+	if handler == nil {
+		return nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = fmt.Sprintf("/%s", path)
+	}
+	t.Lock()
+	defer t.Unlock()
+	if len(method) <= 0 {
+		mLogger.InfoF("注册handler: %s", path)
+		t.router.addRoute(path, "", handler)
+		return nil
+	}
+	mLogger.InfoF("注册handler: %s %s", method, path)
+	t.router.addRoute(path, method, handler)
+	swaggerPath := SwaggerBuildPath(path, "", strings.ToLower(method), "")
+	t.swagger.AddPath(swaggerPath)
+	return swaggerPath
+}
+
+// RegisterGet 注册 GET 请求处理器
+func RegisterGet(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return globalServer.GET(path, handler, middlewares...)
+}
+
+// RegisterPost 注册 POST 请求处理器
+func RegisterPost(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return globalServer.POST(path, handler, middlewares...)
+}
+
+// RegisterPut 注册 PUT 请求处理器
+func RegisterPut(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return globalServer.PUT(path, handler, middlewares...)
+}
+
+// RegisterPatch 注册 PATCH 请求处理器
+func RegisterPatch(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return globalServer.PATCH(path, handler, middlewares...)
+}
+
+// RegisterDelete 注册 DELETE 请求处理器
+func RegisterDelete(path string, handler func(Context), middlewares ...Middleware) *SwaggerPath {
+	return globalServer.DELETE(path, handler, middlewares...)
+}
+
+// RegisterAny 注册匹配所有http方法的处理器
+func RegisterAny(path string, handler func(Context), middlewares ...Middleware) {
+	globalServer.Any(path, handler, middlewares...)
+}
+
+// RegisterRoute 在全局Server注册以指针接收 Context 的处理器
+func RegisterRoute(method string, path string, handler HandlerFunc, middlewares ...Middleware) *SwaggerPath {
+	return globalServer.Route(method, path, handler, middlewares...)
+}
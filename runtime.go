@@ -9,6 +9,7 @@ import (
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
 	"github.com/shirou/gopsutil/v3/process"
+	"github.com/wenlaizhou/middleware/metrics"
 	"runtime"
 	"runtime/debug"
 	"strings"
@@ -484,13 +485,12 @@ func RegisterRuntimeInfoService(path string, labels map[string]string,
 		})
 		return res
 	} else {
+		collectors := []metrics.Collector{RuntimeMetricsCollector(labels), globalServer.Metrics(), metrics.DefaultRegistry}
+		if extendedMetrics != nil {
+			collectors = append(collectors, MetricsDataCollector(extendedMetrics))
+		}
 		RegisterHandler(path, func(context Context) {
-			metrics := GetRuntimeMetrics(labels)
-			if extendedMetrics != nil {
-				metrics = append(metrics, extendedMetrics()...)
-			}
-			PrintMetricsData(metrics, context)
-			return
+			WriteMetrics(context, collectors...)
 		})
 	}
 	return res
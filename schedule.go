@@ -45,6 +45,18 @@ func ScheduleStop(name string) {
 	s.handle <- "stop"
 }
 
+// ScheduleStopAll 停止所有运行中的定时任务, 不等待
+//
+// 可作为 Server 关闭钩子使用
+func ScheduleStopAll() {
+	for name, s := range scheduleRunner {
+		if s.Status == "stop" {
+			continue
+		}
+		go ScheduleStop(name)
+	}
+}
+
 // Schedule 注册定时任务
 //
 // name 任务名称
@@ -119,13 +131,20 @@ func Schedule(name string, timeSchedule int, fun func(), delaySeconds int) {
 //
 // return 返回 swagger 路径数组
 func RegisterScheduleService(path string) []*SwaggerPath {
+	return MountScheduleService(globalServer, path)
+}
+
+// MountScheduleService 在指定 Server 或 Group 上挂载schedule服务接口
+//
+// return 返回 swagger 路径数组, 路径包含分组前缀
+func MountScheduleService(router Router, path string) []*SwaggerPath {
 
-	RegisterHandler(path, func(context Context) {
+	router.RegisterHandler(path, func(context Context) {
 		context.ApiResponse(0, "", scheduleRunner)
 	})
 
 	pausePath := fmt.Sprintf("%v/pause", path)
-	pauseSwagger := SwaggerBuildPath(pausePath, "middleware", "post", "middleware schedule pause")
+	pauseSwagger := SwaggerBuildPath(fmt.Sprintf("%v%v", router.Prefix(), pausePath), "middleware", "post", "middleware schedule pause")
 	pauseSwagger.AddParameter(SwaggerParameter{
 		Name:        "body",
 		Description: "json类型, name:  任务名称",
@@ -135,7 +154,7 @@ func RegisterScheduleService(path string) []*SwaggerPath {
 		In:       "body",
 		Required: true,
 	})
-	RegisterHandler(pausePath, func(context Context) {
+	router.RegisterHandler(pausePath, func(context Context) {
 		params, err := context.GetJSON()
 		if err != nil {
 			context.ApiResponse(-1, err.Error(), nil)
@@ -151,7 +170,7 @@ func RegisterScheduleService(path string) []*SwaggerPath {
 	})
 
 	continuePath := fmt.Sprintf("%v/continue", path)
-	continueSwagger := SwaggerBuildPath(continuePath, "middleware", "post", "middleware schedule continue")
+	continueSwagger := SwaggerBuildPath(fmt.Sprintf("%v%v", router.Prefix(), continuePath), "middleware", "post", "middleware schedule continue")
 	continueSwagger.AddParameter(SwaggerParameter{
 		Name:        "body",
 		Description: "json类型, name:  任务名称",
@@ -161,7 +180,7 @@ func RegisterScheduleService(path string) []*SwaggerPath {
 		In:       "body",
 		Required: true,
 	})
-	RegisterHandler(continuePath, func(context Context) {
+	router.RegisterHandler(continuePath, func(context Context) {
 		params, err := context.GetJSON()
 		if err != nil {
 			context.ApiResponse(-1, err.Error(), nil)
@@ -177,7 +196,7 @@ func RegisterScheduleService(path string) []*SwaggerPath {
 	})
 
 	stopPath := fmt.Sprintf("%v/stop", path)
-	stopSwagger := SwaggerBuildPath(stopPath, "middleware", "post", "middleware schedule stop")
+	stopSwagger := SwaggerBuildPath(fmt.Sprintf("%v%v", router.Prefix(), stopPath), "middleware", "post", "middleware schedule stop")
 	stopSwagger.AddParameter(SwaggerParameter{
 		Name:        "body",
 		Description: "json类型, name:  任务名称",
@@ -187,7 +206,7 @@ func RegisterScheduleService(path string) []*SwaggerPath {
 		In:       "body",
 		Required: true,
 	})
-	RegisterHandler(stopPath, func(context Context) {
+	router.RegisterHandler(stopPath, func(context Context) {
 		params, err := context.GetJSON()
 		if err != nil {
 			context.ApiResponse(-1, err.Error(), nil)
@@ -203,7 +222,7 @@ func RegisterScheduleService(path string) []*SwaggerPath {
 	})
 
 	return []*SwaggerPath{
-		SwaggerBuildPath(path, "middleware", "get", "middleware schedule"),
+		SwaggerBuildPath(fmt.Sprintf("%v%v", router.Prefix(), path), "middleware", "get", "middleware schedule"),
 		pauseSwagger, continueSwagger, stopSwagger,
 	}
 }
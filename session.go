@@ -39,19 +39,35 @@ func newSession(context Context) *Session {
 	return &s
 }
 
-func getSession(context Context) *Session {
-	s, ok := globalSession[context.GetCookie("sessionId")]
-	if ok {
-		return s
+// getSession 获取请求对应session, 同一请求内只创建一次
+func getSession(c *Context) *Session {
+	if c.attrs == nil {
+		c.attrs = &contextAttrs{}
 	}
-	return newSession(context)
+	c.attrs.Lock()
+	defer c.attrs.Unlock()
+	if c.attrs.session != nil {
+		return c.attrs.session
+	}
+	globalSessionLock.RLock()
+	s, ok := globalSession[c.GetCookie("sessionId")]
+	globalSessionLock.RUnlock()
+	if !ok {
+		s = newSession(*c)
+	}
+	c.attrs.session = s
+	return s
 }
 
 func (t *Session) Set(key string, val interface{}) {
+	t.Lock()
 	t.data[key] = val
+	t.Unlock()
 }
 
 func (t *Session) Get(key string) interface{} {
+	t.RLock()
+	defer t.RUnlock()
 	return t.data[key]
 }
 
@@ -73,9 +89,9 @@ func init() {
 }
 
 func (c *Context) SessionSet(key string, value interface{}) {
-	getSession(*c).Set(key, value)
+	getSession(c).Set(key, value)
 }
 
 func (c *Context) SessionGet(key string) interface{} {
-	return getSession(*c).Get(key)
+	return getSession(c).Get(key)
 }
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// 服务状态
+const (
+	ServerIdle     = iota // 未启动
+	ServerStarting        // 启动中
+	ServerRunning         // 运行中
+	ServerDraining        // 停止接收新请求, 等待处理中的请求完成
+	ServerStopped         // 已停止
+)
+
+// RegisterShutdownHook 注册关闭钩子
+//
+// 服务关闭时, 在处理中的请求完成后按注册的逆序执行, 如关闭 Database, 停止 kafka 消费等
+func (t *Server) RegisterShutdownHook(hook func()) {
+	if hook == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.shutdownHooks = append(t.shutdownHooks, hook)
+}
+
+// Shutdown 优雅关闭服务
+//
+// 停止接收新请求, 等待处理中的请求完成或 ctx 超时, 之后执行关闭钩子并刷新日志
+func (t *Server) Shutdown(ctx context.Context) error {
+	t.Lock()
+	if t.status == ServerDraining || t.status == ServerStopped {
+		t.Unlock()
+		return nil
+	}
+	t.status = ServerDraining
+	httpServer := t.httpServer
+	redirectServer := t.redirectServer
+	done := t.done
+	hooks := t.shutdownHooks
+	t.Unlock()
+
+	mLogger.Info("server shutdown")
+	var err error
+	if httpServer != nil {
+		err = httpServer.Shutdown(ctx)
+		if err != nil {
+			mLogger.ErrorF("server shutdown error: %v", err.Error())
+		}
+	}
+	if redirectServer != nil {
+		_ = redirectServer.Shutdown(ctx)
+	}
+	for i := len(hooks) - 1; i >= 0; i-- {
+		runShutdownHook(hooks[i])
+	}
+	FlushLogs()
+	t.setStatus(ServerStopped)
+	if done != nil {
+		close(done)
+	}
+	return err
+}
+
+func runShutdownHook(hook func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			mLogger.ErrorF("shutdown hook error: %v", err)
+		}
+	}()
+	hook()
+}
+
+// EnableGracefulShutdown 接收到 SIGTERM, SIGINT 信号时优雅关闭服务
+//
+// timeoutSeconds: 等待处理中请求完成的最长时间, 单位: 秒
+func (t *Server) EnableGracefulShutdown(timeoutSeconds int) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		mLogger.InfoF("receive signal: %v", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
+		defer cancel()
+		_ = t.Shutdown(ctx)
+	}()
+}
+
+// ShutdownServer 优雅关闭全局Server
+func ShutdownServer(ctx context.Context) error {
+	return globalServer.Shutdown(ctx)
+}
+
+// RegisterShutdownHook 注册全局Server关闭钩子
+func RegisterShutdownHook(hook func()) {
+	globalServer.RegisterShutdownHook(hook)
+}
+
+// EnableGracefulShutdown 接收到 SIGTERM, SIGINT 信号时优雅关闭全局Server
+func EnableGracefulShutdown(timeoutSeconds int) {
+	globalServer.EnableGracefulShutdown(timeoutSeconds)
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerShutdown(t *testing.T) {
+	srv := NewServer("127.0.0.1", 0)
+	var hooks []int
+	srv.RegisterShutdownHook(func() {
+		hooks = append(hooks, 1)
+	})
+	srv.RegisterShutdownHook(func() {
+		hooks = append(hooks, 2)
+	})
+	stopped := make(chan struct{})
+	go func() {
+		srv.Start()
+		close(stopped)
+	}()
+	for i := 0; srv.GetStatus() != ServerRunning; i++ {
+		if i > 100 {
+			t.Fatalf("server not running: %v", srv.GetStatus())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Start not return after Shutdown")
+	}
+	if srv.GetStatus() != ServerStopped {
+		t.Fatalf("status: %v", srv.GetStatus())
+	}
+	if len(hooks) != 2 || hooks[0] != 2 || hooks[1] != 1 {
+		t.Fatalf("hooks: %v", hooks)
+	}
+}
+
+func TestServerShutdownWhileStarting(t *testing.T) {
+	srv := NewServer("127.0.0.1", 0)
+	srv.setStatus(ServerStarting)
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if srv.compareAndSetStatus(ServerStarting, ServerRunning) || srv.GetStatus() != ServerStopped {
+		t.Fatalf("shutdown status overwritten: %v", srv.GetStatus())
+	}
+}
+
+func TestServerStartListenError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	srv := NewServer("127.0.0.1", listener.Addr().(*net.TCPAddr).Port)
+	if err := srv.Start(); err == nil {
+		t.Fatal("listen on used port should return error")
+	}
+	if srv.GetStatus() != ServerIdle {
+		t.Fatalf("status: %v", srv.GetStatus())
+	}
+}
@@ -0,0 +1,367 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSEHeartbeatInterval SSE 心跳间隔, 防止代理因连接空闲断开, 可全局修改
+var SSEHeartbeatInterval = 15 * time.Second
+
+const (
+	EventStream       = "text/event-stream"
+	LastEventIdHeader = "Last-Event-ID"
+)
+
+// SSEvent Server-Sent Event
+type SSEvent struct {
+	// Id 事件id, 客户端重连时通过 Last-Event-ID 头携带最后收到的id
+	Id string
+
+	// Event 事件类型, 为空则客户端触发 message 事件
+	Event string
+
+	// Data 事件数据, 多行数据自动拆分为多个 data 字段
+	Data string
+
+	// Retry 客户端重连间隔, 单位: 毫秒, 0 则不发送
+	Retry int
+}
+
+// SSEStream SSE 输出流, 通过 Context.SSE 创建, 使用完成后需调用 Close
+type SSEStream struct {
+	ctx     Context
+	flusher http.Flusher
+	done    <-chan struct{}
+	stop    chan struct{}
+	merged  chan struct{} // done 或 stop 关闭后关闭
+	closed  bool
+	sync.Mutex
+}
+
+// SSE 开始 SSE 输出, 设置响应头并定时发送心跳
+//
+//	stream, err := c.SSE()
+//	if err != nil {
+//		return
+//	}
+//	defer stream.Close()
+func (c *Context) SSE() (*SSEStream, error) {
+	if !c.writeable {
+		return nil, errors.New("禁止重复写入response")
+	}
+	flusher, ok := c.Response.(http.Flusher)
+	if !ok {
+		return nil, errors.New("response 不支持 Flush")
+	}
+	c.writeable = false
+	c.code = StatusOK
+	c.SetHeader(ContentType, EventStream)
+	c.SetHeader("Cache-Control", "no-cache")
+	c.SetHeader("X-Accel-Buffering", "no")
+	c.Response.WriteHeader(StatusOK)
+	flusher.Flush()
+	stream := &SSEStream{
+		ctx:     *c,
+		flusher: flusher,
+		done:    c.Request.Context().Done(),
+		stop:    make(chan struct{}),
+		merged:  make(chan struct{}),
+	}
+	go stream.heartbeat()
+	return stream, nil
+}
+
+// LastEventId 客户端重连时携带的最后事件id
+func (s *SSEStream) LastEventId() string {
+	if id := s.ctx.GetHeader(LastEventIdHeader); len(id) > 0 {
+		return id
+	}
+	return s.ctx.GetQueryParam("lastEventId")
+}
+
+// Done 客户端断开连接或 Close 后关闭
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.merged
+}
+
+// Send 发送事件并立即 flush
+func (s *SSEStream) Send(event SSEvent) error {
+	builder := &strings.Builder{}
+	if len(event.Id) > 0 {
+		fmt.Fprintf(builder, "id: %s\n", sseField(event.Id))
+	}
+	if len(event.Event) > 0 {
+		fmt.Fprintf(builder, "event: %s\n", sseField(event.Event))
+	}
+	if event.Retry > 0 {
+		fmt.Fprintf(builder, "retry: %d\n", event.Retry)
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(event.Data, "\r\n", "\n"), "\n") {
+		fmt.Fprintf(builder, "data: %s\n", line)
+	}
+	builder.WriteString("\n")
+	return s.write(builder.String())
+}
+
+// SendJSON 以json格式发送事件数据
+func (s *SSEStream) SendJSON(event string, data interface{}) error {
+	res, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return s.Send(SSEvent{Event: event, Data: string(res)})
+}
+
+// Close 停止心跳, 处理器返回前需调用
+func (s *SSEStream) Close() {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.stop)
+}
+
+func (s *SSEStream) write(content string) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return errors.New("sse stream 已关闭")
+	}
+	select {
+	case <-s.done:
+		return errors.New("sse 客户端已断开")
+	default:
+	}
+	if _, err := s.ctx.Response.Write([]byte(content)); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// heartbeat 定时发送心跳, 客户端断开或 Close 后关闭 merged
+func (s *SSEStream) heartbeat() {
+	defer close(s.merged)
+	ticker := time.NewTicker(SSEHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.write(": ping\n\n"); err != nil {
+				ticker.Stop()
+				select {
+				case <-s.done:
+				case <-s.stop:
+				}
+				return
+			}
+		case <-s.done:
+			return
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// sseField id 及 event 字段不能包含换行
+func sseField(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// SSEBroker 按主题分发 SSE 事件
+//
+// 每个主题保留最近的事件用于 Last-Event-ID 断点续传, 每个客户端使用独立缓冲,
+// 客户端缓冲已满时断开该客户端, 避免慢客户端阻塞其他客户端, 客户端重连后通过 Last-Event-ID 补发
+type SSEBroker struct {
+	replaySize   int
+	clientBuffer int
+	topics       map[string]*sseTopic
+	sync.Mutex
+}
+
+type sseTopic struct {
+	seq     uint64
+	events  []SSEvent
+	clients map[*SSESubscription]struct{}
+}
+
+// SSESubscription 主题订阅
+type SSESubscription struct {
+	topic  string
+	events chan SSEvent
+}
+
+// Events 订阅的事件, 取消订阅或客户端过慢被断开时关闭
+func (s *SSESubscription) Events() <-chan SSEvent {
+	return s.events
+}
+
+// NewSSEBroker 创建 SSE 主题分发
+//
+// replaySize: 每个主题保留的最近事件数, clientBuffer: 每个客户端的事件缓冲数
+func NewSSEBroker(replaySize int, clientBuffer int) *SSEBroker {
+	if clientBuffer <= 0 {
+		clientBuffer = 64
+	}
+	return &SSEBroker{
+		replaySize:   replaySize,
+		clientBuffer: clientBuffer,
+		topics:       map[string]*sseTopic{},
+	}
+}
+
+func (b *SSEBroker) topic(name string) *sseTopic {
+	t, has := b.topics[name]
+	if !has {
+		t = &sseTopic{clients: map[*SSESubscription]struct{}{}}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// Publish 发布事件, Id 为空时自动使用主题内递增序号
+func (b *SSEBroker) Publish(topic string, event SSEvent) {
+	b.Lock()
+	defer b.Unlock()
+	t := b.topic(topic)
+	t.seq++
+	if len(event.Id) <= 0 {
+		event.Id = strconv.FormatUint(t.seq, 10)
+	}
+	if b.replaySize > 0 {
+		t.events = append(t.events, event)
+		if len(t.events) > b.replaySize {
+			t.events = append([]SSEvent(nil), t.events[len(t.events)-b.replaySize:]...)
+		}
+	}
+	for sub := range t.clients {
+		select {
+		case sub.events <- event:
+		default:
+			mLogger.WarnF("sse 客户端过慢, 断开连接: %s", topic)
+			delete(t.clients, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// PublishJSON 以json格式发布事件数据
+func (b *SSEBroker) PublishJSON(topic string, event string, data interface{}) error {
+	res, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	b.Publish(topic, SSEvent{Event: event, Data: string(res)})
+	return nil
+}
+
+// Subscribe 订阅主题, lastEventId 不为空时先补发该事件之后的事件, 该事件已不在保留范围内时补发所有保留事件
+func (b *SSEBroker) Subscribe(topic string, lastEventId string) *SSESubscription {
+	b.Lock()
+	defer b.Unlock()
+	t := b.topic(topic)
+	var replay []SSEvent
+	if len(lastEventId) > 0 {
+		replay = t.events
+		for i, event := range t.events {
+			if event.Id == lastEventId {
+				replay = t.events[i+1:]
+				break
+			}
+		}
+	}
+	sub := &SSESubscription{
+		topic:  topic,
+		events: make(chan SSEvent, b.clientBuffer+len(replay)),
+	}
+	for _, event := range replay {
+		sub.events <- event
+	}
+	t.clients[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe 取消订阅
+func (b *SSEBroker) Unsubscribe(sub *SSESubscription) {
+	b.Lock()
+	defer b.Unlock()
+	t, has := b.topics[sub.topic]
+	if !has {
+		return
+	}
+	if _, has = t.clients[sub]; has {
+		delete(t.clients, sub)
+		close(sub.events)
+	}
+}
+
+// Clients 主题当前的订阅数
+func (b *SSEBroker) Clients(topic string) int {
+	b.Lock()
+	defer b.Unlock()
+	if t, has := b.topics[topic]; has {
+		return len(t.clients)
+	}
+	return 0
+}
+
+// Serve 以 SSE 输出主题事件, 直至客户端断开
+func (b *SSEBroker) Serve(ctx Context, topic string) {
+	stream, err := ctx.SSE()
+	if err != nil {
+		mLogger.ErrorF("sse error: %v", err.Error())
+		ctx.Error(StatusInternalServerError, err.Error())
+		return
+	}
+	defer stream.Close()
+	sub := b.Subscribe(topic, stream.LastEventId())
+	defer b.Unsubscribe(sub)
+	done := ctx.Request.Context().Done()
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			if err = stream.Send(event); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// Handler 返回输出主题事件的处理器
+func (b *SSEBroker) Handler(topic string) func(Context) {
+	return func(context Context) {
+		b.Serve(context, topic)
+	}
+}
+
+// 默认全局 SSE 主题分发, 每个主题保留最近100条事件
+var globalBroker = NewSSEBroker(100, 64)
+
+// GetSSEBroker 获取全局 SSE 主题分发
+func GetSSEBroker() *SSEBroker {
+	return globalBroker
+}
+
+// SSEPublish 向全局 SSE 主题发布事件
+func SSEPublish(topic string, event SSEvent) {
+	globalBroker.Publish(topic, event)
+}
+
+// RegisterSSETopic 在全局Server注册 GET 处理器, 以 SSE 输出全局主题事件
+func RegisterSSETopic(path string, topic string) *SwaggerPath {
+	return globalServer.GET(path, globalBroker.Handler(topic))
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSEBroker(t *testing.T) {
+	broker := NewSSEBroker(10, 4)
+	broker.Publish("status", SSEvent{Data: "old-1"})
+	broker.Publish("status", SSEvent{Data: "old-2"})
+
+	srv := NewServer("", 0)
+	srv.GET("/events", broker.Handler("status"))
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	req, _ := http.NewRequest(GET, server.URL+"/events", nil)
+	req.Header.Set(LastEventIdHeader, "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get(ContentType) != EventStream {
+		t.Fatalf("sse content type error: %v", resp.Header)
+	}
+	for i := 0; i < 100 && broker.Clients("status") <= 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	broker.Publish("status", SSEvent{Event: "progress", Data: "line1\nline2"})
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 8 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	expected := []string{"id: 2", "data: old-2", "", "id: 3", "event: progress", "data: line1", "data: line2", ""}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Fatalf("sse events error: %q", lines)
+	}
+}
+
+func TestSSEBrokerSlowClient(t *testing.T) {
+	broker := NewSSEBroker(0, 2)
+	slow := broker.Subscribe("topic", "")
+	fast := broker.Subscribe("topic", "")
+	for i := 0; i < 3; i++ {
+		broker.Publish("topic", SSEvent{Data: "data"})
+		<-fast.Events()
+	}
+	if broker.Clients("topic") != 1 {
+		t.Fatalf("slow client not removed: %v", broker.Clients("topic"))
+	}
+	count := 0
+	for range slow.Events() {
+		count++
+	}
+	if count != 2 {
+		t.Fatalf("slow client events error: %v", count)
+	}
+	broker.Unsubscribe(slow)
+	broker.Unsubscribe(fast)
+}
+
+func TestSSEStreamDone(t *testing.T) {
+	srv := NewServer("", 0)
+	result := make(chan string, 1)
+	srv.Route(GET, "/stream", func(c *Context) {
+		stream, err := c.SSE()
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		before := runtime.NumGoroutine()
+		for i := 0; i < 100; i++ {
+			select {
+			case <-stream.Done():
+			default:
+			}
+		}
+		if after := runtime.NumGoroutine(); after > before {
+			result <- fmt.Sprintf("Done leaks goroutines: %v -> %v", before, after)
+			return
+		}
+		stream.Close()
+		select {
+		case <-stream.Done():
+			result <- ""
+		case <-time.After(time.Second):
+			result <- "Done not closed after Close"
+		}
+	})
+	server := httptest.NewServer(srv)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if msg := <-result; len(msg) > 0 {
+		t.Fatal(msg)
+	}
+}
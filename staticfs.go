@@ -0,0 +1,247 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"mime"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ImmutableCacheControl 带内容哈希的静态资源缓存策略
+const ImmutableCacheControl = "public, max-age=31536000, immutable"
+
+// staticFS 基于 fs.FS 的静态资源处理, 可直接使用 //go:embed 嵌入的文件
+type staticFS struct {
+	fsys   fs.FS
+	prefix string
+	spa    bool
+	etags  map[string]string
+	sync.RWMutex
+}
+
+// StaticFS 注册 fs.FS 静态资源, prefix 下的请求映射至 fsys 根目录
+//
+//	//go:embed static
+//	var static embed.FS
+//
+//	sub, _ := fs.Sub(static, "static")
+//	srv.StaticFS("/static", sub)
+//
+// 存在 .gz 文件且客户端支持 gzip 时返回压缩文件, ETag 由文件内容哈希生成,
+// 文件名带内容哈希的资源(如 app.3f2a1b9c.js, index-BxY3kZ9a.js)使用 ImmutableCacheControl 缓存
+func (t *Server) StaticFS(prefix string, fsys fs.FS) {
+	t.registerStaticFS(prefix, fsys, false)
+}
+
+// RegisterFrontendDistFS 注册前端编译目录, 在 StaticFS 基础上, 不存在且不是静态资源的路径返回 index.html,
+// 用于前端 history 路由
+//
+//	//go:embed dist
+//	var dist embed.FS
+//
+//	sub, _ := fs.Sub(dist, "dist")
+//	srv.RegisterFrontendDistFS(sub, "/")
+func (t *Server) RegisterFrontendDistFS(fsys fs.FS, prefix string) {
+	t.registerStaticFS(prefix, fsys, true)
+}
+
+// StaticFS 在全局Server注册 fs.FS 静态资源
+func StaticFS(prefix string, fsys fs.FS) {
+	globalServer.StaticFS(prefix, fsys)
+}
+
+// RegisterFrontendDistFS 在全局Server注册前端编译目录
+func RegisterFrontendDistFS(fsys fs.FS, prefix string) {
+	globalServer.RegisterFrontendDistFS(fsys, prefix)
+}
+
+func (t *Server) registerStaticFS(prefix string, fsys fs.FS, spa bool) {
+	prefix = strings.TrimSpace(prefix)
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = fmt.Sprintf("/%s", prefix)
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = fmt.Sprintf("%s/", prefix)
+	}
+	s := &staticFS{
+		fsys:   fsys,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		spa:    spa,
+		etags:  map[string]string{},
+	}
+	t.RegisterHandler(prefix, s.serve)
+	if prefix == "/" {
+		t.RegisterIndex(s.serve)
+		return
+	}
+	t.RegisterHandler(s.prefix, s.serve)
+}
+
+func (s *staticFS) serve(context Context) {
+	urlPath := path.Clean("/" + context.Request.URL.Path)
+	if !strings.HasPrefix(urlPath+"/", s.prefix+"/") {
+		context.Error(StatusNotFound, StatusNotFoundView)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(urlPath, s.prefix), "/")
+	if len(name) <= 0 {
+		name = "."
+	}
+	info, err := fs.Stat(s.fsys, name)
+	if err == nil && info.IsDir() {
+		// 目录需以 / 结尾, 保证页面中的相对路径正确
+		if !strings.HasSuffix(context.Request.URL.Path, "/") {
+			localRedirect(context, path.Base(context.Request.URL.Path)+"/")
+			return
+		}
+		name = path.Join(name, "index.html")
+		info, err = fs.Stat(s.fsys, name)
+	}
+	if err != nil || info.IsDir() {
+		if !s.spa || !isHistoryPath(context, name) {
+			msg, code := toHTTPError(fs.ErrNotExist)
+			context.Error(code, msg)
+			return
+		}
+		name = "index.html"
+	}
+	s.serveFile(context, name)
+}
+
+// isHistoryPath 前端路由路径, 不带扩展名或以 .html 结尾的 GET 请求
+func isHistoryPath(context Context, name string) bool {
+	if context.GetMethod() != GET && context.GetMethod() != HEAD {
+		return false
+	}
+	ext := path.Ext(name)
+	return len(ext) <= 0 || ext == ".html"
+}
+
+func (s *staticFS) serveFile(context Context, name string) {
+	ctype := mime.TypeByExtension(path.Ext(name))
+	servedName := name
+	if _, err := fs.Stat(s.fsys, name+".gz"); err == nil {
+		context.Response.Header().Add(Vary, "Accept-Encoding")
+		if acceptsGzip(context.GetHeader("Accept-Encoding")) {
+			servedName = name + ".gz"
+			context.SetHeader("Content-Encoding", "gzip")
+			if len(ctype) <= 0 {
+				ctype = "application/octet-stream"
+			}
+		}
+	}
+	if len(ctype) > 0 {
+		context.SetHeader(ContentType, ctype)
+	}
+	f, err := s.fsys.Open(servedName)
+	if ProcessError(err) {
+		context.DelHeader("Content-Encoding")
+		msg, code := toHTTPError(err)
+		context.Error(code, msg)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if ProcessError(err) {
+		context.DelHeader("Content-Encoding")
+		msg, code := toHTTPError(err)
+		context.Error(code, msg)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := ioutil.ReadAll(f)
+		if ProcessError(err) {
+			context.DelHeader("Content-Encoding")
+			context.Error(StatusInternalServerError, "500 Internal Server Error")
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	etag, err := s.etag(servedName, info, content)
+	if ProcessError(err) {
+		context.DelHeader("Content-Encoding")
+		context.Error(StatusInternalServerError, "500 Internal Server Error")
+		return
+	}
+	context.SetHeader("Etag", etag)
+	if path.Base(name) != "index.html" && isFingerprinted(name) {
+		context.SetHeader("Cache-Control", ImmutableCacheControl)
+	} else {
+		context.SetHeader("Cache-Control", "no-cache")
+	}
+	serveContent(context, name, info.ModTime(), info.Size(), content)
+}
+
+// etag 计算文件内容哈希, 按文件名, 修改时间及大小缓存
+func (s *staticFS) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	key := fmt.Sprintf("%s|%d|%d", name, info.ModTime().UnixNano(), info.Size())
+	s.RLock()
+	etag, has := s.etags[key]
+	s.RUnlock()
+	if has {
+		return etag, nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag = fmt.Sprintf(`"%s"`, hex.EncodeToString(hash.Sum(nil))[:32])
+	s.Lock()
+	s.etags[key] = etag
+	s.Unlock()
+	return etag, nil
+}
+
+func acceptsGzip(acceptEncoding string) bool {
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(item, ";")
+		if strings.TrimSpace(strings.ToLower(params[0])) != "gzip" {
+			continue
+		}
+		for _, param := range params[1:] {
+			if q := strings.ReplaceAll(strings.TrimSpace(param), " ", ""); q == "q=0" || q == "q=0.0" || q == "q=0.00" || q == "q=0.000" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isFingerprinted 文件名是否带内容哈希
+//
+// 扩展名前以 . 或 - 分隔的部分长度不少于8, 仅包含字母数字及下划线, 且包含数字
+func isFingerprinted(name string) bool {
+	base := path.Base(name)
+	base = strings.TrimSuffix(base, path.Ext(base))
+	index := strings.LastIndexAny(base, ".-")
+	if index < 0 {
+		return false
+	}
+	segment := base[index+1:]
+	if len(segment) < 8 {
+		return false
+	}
+	hasDigit := false
+	for _, c := range segment {
+		switch {
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		default:
+			return false
+		}
+	}
+	return hasDigit
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStaticFS(t *testing.T) {
+	gz := &bytes.Buffer{}
+	writer := gzip.NewWriter(gz)
+	_, _ = writer.Write([]byte("console.log('app')"))
+	_ = writer.Close()
+	dist := fstest.MapFS{
+		"index.html":                {Data: []byte("<div id=app></div>")},
+		"assets/app.3f2a1b9c.js":    {Data: []byte("console.log('app')")},
+		"assets/app.3f2a1b9c.js.gz": {Data: gz.Bytes()},
+		"assets/logo.svg":           {Data: []byte("<svg></svg>")},
+	}
+	srv := NewServer("", 0)
+	srv.RegisterFrontendDistFS(dist, "/ui")
+	srv.StaticFS("/static", dist)
+
+	get := func(target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(GET, target, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/ui/assets/app.3f2a1b9c.js", nil)
+	if w.Code != StatusOK || w.Body.String() != "console.log('app')" || w.Header().Get("Cache-Control") != ImmutableCacheControl ||
+		w.Header().Get(Vary) != "Accept-Encoding" || len(w.Header().Get("Etag")) <= 0 {
+		t.Fatalf("asset error: %v %v %v", w.Code, w.Body.String(), w.Header())
+	}
+	etag := w.Header().Get("Etag")
+	if w = get("/ui/assets/app.3f2a1b9c.js", map[string]string{"If-None-Match": etag}); w.Code != StatusNotModified {
+		t.Fatalf("etag not matched: %v", w.Code)
+	}
+
+	w = get("/ui/assets/app.3f2a1b9c.js", map[string]string{"Accept-Encoding": "br, gzip"})
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get(ContentType) != "text/javascript; charset=utf-8" ||
+		w.Header().Get("Etag") == etag {
+		t.Fatalf("precompressed error: %v", w.Header())
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(reader); string(data) != "console.log('app')" {
+		t.Fatalf("precompressed content error: %q", data)
+	}
+
+	if w = get("/ui/assets/logo.svg", nil); w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("unfingerprinted cache error: %v", w.Header())
+	}
+	for _, target := range []string{"/ui/", "/ui/users/1", "/ui/settings.html"} {
+		if w = get(target, nil); w.Code != StatusOK || w.Body.String() != "<div id=app></div>" || w.Header().Get("Cache-Control") != "no-cache" {
+			t.Fatalf("history fallback error: %v %v %v", target, w.Code, w.Body.String())
+		}
+	}
+	if w = get("/ui", nil); w.Code != StatusMovedPermanently || w.Header().Get("Location") != "ui/" {
+		t.Fatalf("prefix redirect error: %v %v", w.Code, w.Header())
+	}
+	if w = get("/ui/assets/missing.js", nil); w.Code != StatusNotFound {
+		t.Fatalf("missing asset error: %v", w.Code)
+	}
+	if w = get("/static/users/1", nil); w.Code != StatusNotFound {
+		t.Fatalf("static fallback error: %v", w.Code)
+	}
+}
+
+func TestIsFingerprinted(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"app.3f2a1b9c.js":      true,
+		"index-BxY3kZ9a.js":    true,
+		"chunk-vendors.css":    false,
+		"template.js":          false,
+		"logo.svg":             false,
+		"main.abcdef12.css.gz": false,
+	} {
+		if isFingerprinted(name) != expected {
+			t.Fatalf("fingerprint %v error", name)
+		}
+	}
+}
@@ -345,10 +345,19 @@ func (t *Server) EnableSwagger(swaggerData *SwaggerData) {
 	})
 
 	t.RegisterHandler("/swagger-ui.json", func(context Context) {
-		context.OK(Json, []byte(GenerateSwagger(swaggerData)))
+		context.OK(Json, []byte(GenerateSwagger(t.mergeSwagger(swaggerData))))
 	})
 }
 
+// mergeSwagger 合并按http方法注册的路由, 同路径同方法以 swaggerData 中的描述为准
+func (t *Server) mergeSwagger(swaggerData *SwaggerData) *SwaggerData {
+	t.RLock()
+	defer t.RUnlock()
+	res := *swaggerData
+	res.Apis = append(append([]*SwaggerPath{}, t.swagger.Apis...), swaggerData.Apis...)
+	return &res
+}
+
 func EnableSwagger(data *SwaggerData) {
 	globalServer.EnableSwagger(data)
 }
@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSConfig https 配置
+type TLSConfig struct {
+	// CertFile 证书文件路径, pem格式
+	CertFile string
+
+	// KeyFile 私钥文件路径, pem格式
+	KeyFile string
+
+	// MinVersion 最低tls版本, 默认为 tls.VersionTLS12
+	MinVersion uint16
+
+	// CipherSuites 加密套件, 为空则使用golang默认值
+	CipherSuites []uint16
+
+	// ClientCAFile 客户端证书CA文件, 不为空则开启双向认证(mTLS)
+	ClientCAFile string
+
+	// ClientCertOptional 为 true 时客户端证书可选, 提供则进行校验
+	ClientCertOptional bool
+
+	// ReloadSeconds 检查证书文件变化的间隔时间, 单位: 秒, 默认10秒
+	ReloadSeconds int
+
+	// RedirectPort 大于0时在该端口启动http服务, 将请求跳转至https
+	RedirectPort int
+}
+
+// EnableTLS 开启https, 证书文件变化后自动重新加载, 无需重启服务
+//
+// 需在 Start 之前调用, 证书加载失败则返回错误
+func (t *Server) EnableTLS(conf TLSConfig) error {
+	if HasEmptyString(conf.CertFile, conf.KeyFile) {
+		return errors.New("证书文件路径为空")
+	}
+	if conf.MinVersion <= 0 {
+		conf.MinVersion = tls.VersionTLS12
+	}
+	if conf.ReloadSeconds <= 0 {
+		conf.ReloadSeconds = 10
+	}
+	reloader := &certReloader{
+		conf: conf,
+	}
+	if err := reloader.load(); err != nil {
+		return err
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.certReloader = reloader
+	return nil
+}
+
+// EnableTLS 全局Server开启https
+func EnableTLS(conf TLSConfig) error {
+	return globalServer.EnableTLS(conf)
+}
+
+// serveTLS 启动证书重新加载及http跳转服务, 返回tls listener
+func (t *Server) serveTLS(listener net.Listener, done chan struct{}) net.Listener {
+	t.RLock()
+	reloader := t.certReloader
+	t.RUnlock()
+	if reloader == nil {
+		return listener
+	}
+	go reloader.watch(done)
+	if reloader.conf.RedirectPort > 0 {
+		redirectServer := &http.Server{
+			Addr:    fmt.Sprintf("%s:%d", t.Host, reloader.conf.RedirectPort),
+			Handler: http.HandlerFunc(t.redirectHttps),
+		}
+		t.Lock()
+		t.redirectServer = redirectServer
+		t.Unlock()
+		go func() {
+			mLogger.InfoF("https redirect server start %v", redirectServer.Addr)
+			if err := redirectServer.ListenAndServe(); err != http.ErrServerClosed {
+				mLogger.ErrorF("https redirect server error: %v", err.Error())
+			}
+		}()
+	}
+	return tls.NewListener(listener, reloader.tlsConfig())
+}
+
+// redirectHttps http请求跳转至https
+func (t *Server) redirectHttps(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if t.Port != 443 {
+		host = net.JoinHostPort(host, fmt.Sprintf("%d", t.Port))
+	}
+	http.Redirect(w, r, fmt.Sprintf("https://%s%s", host, r.URL.RequestURI()), http.StatusMovedPermanently)
+}
+
+// certReloader 证书加载, 定时检查证书文件变化
+type certReloader struct {
+	sync.RWMutex
+	conf     TLSConfig
+	config   *tls.Config
+	modTimes map[string]time.Time
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.conf.CertFile, r.conf.KeyFile}
+	if len(r.conf.ClientCAFile) > 0 {
+		files = append(files, r.conf.ClientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) load() error {
+	modTimes := map[string]time.Time{}
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+	cert, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{
+		MinVersion:   r.conf.MinVersion,
+		CipherSuites: r.conf.CipherSuites,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if len(r.conf.ClientCAFile) > 0 {
+		caData, err := ioutil.ReadFile(r.conf.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return errors.New(fmt.Sprintf("客户端CA证书解析错误: %v", r.conf.ClientCAFile))
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		if r.conf.ClientCertOptional {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	r.Lock()
+	r.config = config
+	r.modTimes = modTimes
+	r.Unlock()
+	return nil
+}
+
+// changed 证书文件是否发生变化
+func (r *certReloader) changed() bool {
+	r.RLock()
+	defer r.RUnlock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false
+		}
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *certReloader) watch(done chan struct{}) {
+	ticker := time.NewTicker(time.Duration(r.conf.ReloadSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.load(); err != nil {
+				mLogger.ErrorF("证书重新加载失败, 继续使用原证书: %v", err.Error())
+				continue
+			}
+			mLogger.InfoF("证书重新加载: %v", strings.Join(r.files(), ","))
+		}
+	}
+}
+
+// tlsConfig 每次握手使用最新加载的证书配置
+func (r *certReloader) tlsConfig() *tls.Config {
+	current := func() *tls.Config {
+		r.RLock()
+		defer r.RUnlock()
+		return r.config
+	}
+	return &tls.Config{
+		MinVersion: r.conf.MinVersion,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &current().Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return current(), nil
+		},
+	}
+}
+
+// PeerCertificate 获取双向认证中客户端证书, 非https或客户端未提供证书则返回 nil
+func (c *Context) PeerCertificate() *x509.Certificate {
+	if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) <= 0 {
+		return nil
+	}
+	return c.Request.TLS.PeerCertificates[0]
+}
+
+// PeerIdentity 获取客户端证书身份(Subject CommonName), 无客户端证书则返回 ""
+func (c *Context) PeerIdentity() string {
+	cert := c.PeerCertificate()
+	if cert == nil {
+		return ""
+	}
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tpl, key
+	if parent == nil {
+		tpl.IsCA = true
+		tpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) write(t *testing.T, certFile string, keyFile string) {
+	keyDer, _ := x509.MarshalECPrivateKey(c.key)
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if len(keyFile) > 0 {
+		if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServerTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt")
+	ca := newTestCert(t, "ca", 1, nil)
+	ca.write(t, caFile, "")
+	newTestCert(t, "server-1", 2, ca).write(t, certFile, keyFile)
+	client := newTestCert(t, "client", 3, ca)
+
+	srv := NewServer("127.0.0.1", 0)
+	srv.RegisterHandler("/whoami", func(c Context) {
+		c.OK(Plain, []byte(c.PeerIdentity()))
+	})
+	if err := srv.EnableTLS(TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(srv)
+	ts.TLS = srv.certReloader.tlsConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	httpClient := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig: &tls.Config{
+			RootCAs: roots,
+			Certificates: []tls.Certificate{{
+				Certificate: [][]byte{client.der},
+				PrivateKey:  client.key,
+			}},
+		},
+	}}
+	get := func() (string, string) {
+		resp, err := httpClient.Get(ts.URL + "/whoami")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body), resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	if peer, serverName := get(); peer != "client" || serverName != "server-1" {
+		t.Fatalf("peer: %v, server: %v", peer, serverName)
+	}
+
+	newTestCert(t, "server-2", 4, ca).write(t, certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	if !srv.certReloader.changed() {
+		t.Fatal("cert change not detected")
+	}
+	if err := srv.certReloader.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, serverName := get(); serverName != "server-2" {
+		t.Fatalf("cert not reloaded: %v", serverName)
+	}
+}
@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	RequestIdHeader = "X-Request-Id"
+	Traceparent     = "traceparent"
+	Tracestate      = "tracestate"
+)
+
+// TraceContext 请求追踪信息, 遵循 W3C trace-context
+//
+// traceparent: {version}-{TraceId}-{SpanId}-{Flags}, 如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+type TraceContext struct {
+	// RequestId 请求id, 取自请求头 X-Request-Id, 未携带时使用 TraceId
+	RequestId string
+
+	// TraceId 32位16进制 trace id, 取自请求头 traceparent, 未携带时生成
+	TraceId string
+
+	// SpanId 本服务处理该请求的 span id, 16位16进制
+	SpanId string
+
+	// ParentSpanId 上游 span id, 未携带 traceparent 时为空
+	ParentSpanId string
+
+	// Flags trace flags, 如 01 表示采样
+	Flags string
+
+	// State 请求头 tracestate, 原样向下游传递
+	State string
+}
+
+// Traceparent 向下游传递的 traceparent, 以本服务 SpanId 作为 parent-id
+func (t TraceContext) Traceparent() string {
+	if len(t.TraceId) <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-%s", t.TraceId, t.SpanId, t.Flags)
+}
+
+// Headers 调用下游服务时需要携带的请求头
+func (t TraceContext) Headers() map[string]string {
+	res := map[string]string{}
+	if len(t.RequestId) > 0 {
+		res[RequestIdHeader] = t.RequestId
+	}
+	if traceparent := t.Traceparent(); len(traceparent) > 0 {
+		res[Traceparent] = traceparent
+	}
+	if len(t.State) > 0 {
+		res[Tracestate] = t.State
+	}
+	return res
+}
+
+type traceContextKey struct{}
+
+// WithTrace 将追踪信息存入 context.Context
+func WithTrace(ctx context.Context, trace TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, trace)
+}
+
+// TraceFromContext 获取 context.Context 中的追踪信息
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	if ctx == nil {
+		return TraceContext{}, false
+	}
+	trace, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return trace, ok
+}
+
+// requestIdReg 请求头中的 X-Request-Id 需满足该格式, 防止日志注入
+var requestIdReg = regexp.MustCompile(`^[a-zA-Z0-9._\-]{1,128}$`)
+
+var traceparentReg = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// newTraceContext 解析请求头中的 X-Request-Id, traceparent, tracestate, 不存在或格式错误时生成
+func newTraceContext(r *http.Request) TraceContext {
+	trace := TraceContext{
+		SpanId: randomHex(8),
+		Flags:  "01",
+	}
+	if matches := traceparentReg.FindStringSubmatch(strings.TrimSpace(r.Header.Get(Traceparent))); matches != nil &&
+		matches[1] != "ff" && strings.Trim(matches[2], "0") != "" && strings.Trim(matches[3], "0") != "" {
+		trace.TraceId = matches[2]
+		trace.ParentSpanId = matches[3]
+		trace.Flags = matches[4]
+		trace.State = r.Header.Get(Tracestate)
+	} else {
+		trace.TraceId = randomHex(16)
+	}
+	if requestId := strings.TrimSpace(r.Header.Get(RequestIdHeader)); requestIdReg.MatchString(requestId) {
+		trace.RequestId = requestId
+	} else {
+		trace.RequestId = trace.TraceId
+	}
+	return trace
+}
+
+func randomHex(size int) string {
+	buf := make([]byte, size)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// RequestId 请求id
+func (c *Context) RequestId() string {
+	return c.trace.RequestId
+}
+
+// Trace 请求追踪信息
+func (c *Context) Trace() TraceContext {
+	return c.trace
+}
+
+// Context 同 Ctx, 保留以兼容已有调用
+func (c *Context) Context() context.Context {
+	return c.Ctx()
+}
+
+// Logger 获取日志服务, 每行日志以 [请求id] 开头
+func (c *Context) Logger(name string) Logger {
+	return &traceLogger{
+		Logger: GetLogger(name),
+		prefix: fmt.Sprintf("[%s] ", c.trace.RequestId),
+	}
+}
+
+// traceLogger 为日志添加请求id前缀
+type traceLogger struct {
+	Logger
+	prefix string
+}
+
+func (t *traceLogger) Log(msg string) {
+	t.Logger.Log(t.prefix + msg)
+}
+
+func (t *traceLogger) LogF(formatter string, records ...interface{}) {
+	t.Logger.LogF(t.prefix+formatter, records...)
+}
+
+func (t *traceLogger) ConsoleLogF(formatter string, records ...interface{}) {
+	t.Logger.ConsoleLogF(t.prefix+formatter, records...)
+}
+
+func (t *traceLogger) LogTemplate(tpl string, models ...interface{}) {
+	t.Logger.LogTemplate(t.prefix+tpl, models...)
+}
+
+func (t *traceLogger) Info(msg string) {
+	t.Logger.Info(t.prefix + msg)
+}
+
+func (t *traceLogger) InfoLn(v ...interface{}) {
+	t.Logger.InfoLn(append([]interface{}{strings.TrimSpace(t.prefix)}, v...)...)
+}
+
+func (t *traceLogger) InfoF(formatter string, records ...interface{}) {
+	t.Logger.InfoF(t.prefix+formatter, records...)
+}
+
+func (t *traceLogger) InfoTemplate(tpl string, models ...interface{}) {
+	t.Logger.InfoTemplate(t.prefix+tpl, models...)
+}
+
+func (t *traceLogger) Warn(msg string) {
+	t.Logger.Warn(t.prefix + msg)
+}
+
+func (t *traceLogger) WarnF(formatter string, records ...interface{}) {
+	t.Logger.WarnF(t.prefix+formatter, records...)
+}
+
+func (t *traceLogger) ConsoleWarnF(formatter string, records ...interface{}) {
+	t.Logger.ConsoleWarnF(t.prefix+formatter, records...)
+}
+
+func (t *traceLogger) WarnTemplate(tpl string, models ...interface{}) {
+	t.Logger.WarnTemplate(t.prefix+tpl, models...)
+}
+
+func (t *traceLogger) Error(msg string) {
+	t.Logger.Error(t.prefix + msg)
+}
+
+func (t *traceLogger) ErrorF(formatter string, records ...interface{}) {
+	t.Logger.ErrorF(t.prefix+formatter, records...)
+}
+
+func (t *traceLogger) ConsoleErrorF(formatter string, records ...interface{}) {
+	t.Logger.ConsoleErrorF(t.prefix+formatter, records...)
+}
+
+func (t *traceLogger) ErrorTemplate(tpl string, models ...interface{}) {
+	t.Logger.ErrorTemplate(t.prefix+tpl, models...)
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTraceContext(t *testing.T) {
+	var downstream TraceContext
+	backend := httptest.NewServer(NewServer("", 0))
+	defer backend.Close()
+	backendSrv := backend.Config.Handler.(*Server)
+	backendSrv.GET("/downstream", func(c Context) {
+		downstream = c.Trace()
+		c.OK(Plain, []byte(c.RequestId()))
+	})
+
+	srv := NewServer("", 0)
+	srv.GET("/upstream", func(c Context) {
+		code, _, body, err := DoRequestContext(c.Context(), 5, GET, backend.URL+"/downstream", nil, "", nil)
+		if err != nil || code != StatusOK {
+			c.Error(StatusBadGateway, "")
+			return
+		}
+		c.OK(Plain, body)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(GET, "/upstream", nil)
+	req.Header.Set(RequestIdHeader, "req-1")
+	req.Header.Set(Traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(Tracestate, "vendor=1")
+	srv.ServeHTTP(w, req)
+	if w.Code != StatusOK || w.Body.String() != "req-1" || w.Header().Get(RequestIdHeader) != "req-1" {
+		t.Fatalf("request id error: %v %v %v", w.Code, w.Body.String(), w.Header())
+	}
+	if downstream.TraceId != "4bf92f3577b34da6a3ce929d0e0e4736" || downstream.State != "vendor=1" ||
+		len(downstream.ParentSpanId) != 16 || downstream.ParentSpanId == "00f067aa0ba902b7" {
+		t.Fatalf("trace propagation error: %+v", downstream)
+	}
+
+	// 非法 traceparent 及 X-Request-Id 重新生成
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(GET, "/downstream", nil)
+	req.Header.Set(RequestIdHeader, "bad id\n")
+	req.Header.Set(Traceparent, "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	backendSrv.ServeHTTP(w, req)
+	if len(downstream.TraceId) != 32 || downstream.TraceId == "00000000000000000000000000000000" ||
+		len(downstream.ParentSpanId) > 0 || downstream.RequestId != downstream.TraceId {
+		t.Fatalf("trace generate error: %+v", downstream)
+	}
+}
@@ -1,119 +1,252 @@
 package middleware
 
-import "strings"
-
-/*
-type Trie struct {
-	path string
-	handler func(Context)
-	children map[string]Trie
+import (
+	"sort"
+	"strings"
+)
+
+// TrieNode 路由前缀树节点
+//
+// 路径按 / 分段逐级匹配, 同一层级的优先级为: 静态分段 > {参数}分段 > 以 / 结尾注册的通配路径
+//
+// 查找耗时只与请求路径长度相关, 与注册的路由数量无关
+type TrieNode struct {
+	Path    string
+	Handler func(Context) // root handler 为默认处理器
+	Next    map[string]*TrieNode
+	param   *TrieNode // {参数} 分段子节点
+	exact   *route    // 精确匹配到该节点的路由
+	prefix  *route    // 以 / 结尾注册, 匹配该节点之下所有路径的路由
 }
 
-data map[string]Trie
-
-func Constructor() Trie {
-
+// route 路由终点
+type route struct {
+	pattern string
+	params  []string
+	handler HandlerFunc            // 匹配所有http方法的处理器
+	methods map[string]HandlerFunc // 按http方法注册的处理器
+	cors    *CorsPolicy            // 路由跨域策略
+	group   *Group                 // 路由所属分组, 用于获取分组跨域策略
 }
 
-func (this *Trie) Insert(word string)  {
+func NewTrieNode(defaultHandler func(Context)) *TrieNode {
+	return &TrieNode{
+		Path:    "/",
+		Handler: defaultHandler,
+		Next:    map[string]*TrieNode{},
+	}
+}
 
+// AddPath 注册路径
+//
+// path: 可以用 {占位符} 进行路径参数设置, 以 / 结尾则匹配该路径之下的所有路径
+func (this *TrieNode) AddPath(path string, handler func(Context)) {
+	this.addRoute(path, "", WrapHandler(handler))
 }
 
-func (this *Trie) Search(word string) bool {
-	paths = string.split(word, "/")
-	for index, p := range paths {
-		Search(wordSub)
-		//children 是否还存在, 是否匹配对应路径, 以上都是否, 则直接返回handler
+// FindPath 查找路径对应处理器, 未找到则返回默认处理器
+func (this *TrieNode) FindPath(path string) func(Context) {
+	r, _ := this.lookup(path)
+	if r == nil {
+		return this.Handler
+	}
+	if r.handler == nil {
+		return nil
+	}
+	handler := r.handler
+	return func(c Context) {
+		handler(&c)
 	}
 }
 
-func (this *Trie) StartsWith(prefix string) bool {
-
+// addRoute 注册路由, method 为空则匹配所有http方法
+func (this *TrieNode) addRoute(pattern string, method string, handler HandlerFunc) *route {
+	segments := splitPath(pattern)
+	isPrefix := false
+	if segments[len(segments)-1] == "" {
+		isPrefix = true
+		segments = segments[:len(segments)-1]
+	}
+	node := this
+	var params []string
+	for _, segment := range segments {
+		if name, isParam := pathParamName(segment); isParam {
+			if node.param == nil {
+				node.param = &TrieNode{
+					Path: segment,
+					Next: map[string]*TrieNode{},
+				}
+			}
+			params = append(params, name)
+			node = node.param
+			continue
+		}
+		child, has := node.Next[segment]
+		if !has {
+			child = &TrieNode{
+				Path: segment,
+				Next: map[string]*TrieNode{},
+			}
+			node.Next[segment] = child
+		}
+		node = child
+	}
+	target := &node.exact
+	if isPrefix {
+		target = &node.prefix
+	}
+	r := *target
+	if r == nil {
+		r = &route{
+			pattern: pattern,
+			params:  params,
+			methods: map[string]HandlerFunc{},
+		}
+		*target = r
+	} else if !equalStrings(r.params, params) {
+		// 同一路由的占位符名称以最后一次注册为准
+		mLogger.WarnF("路由占位符名称不一致: %s, %s", r.pattern, pattern)
+		r.pattern = pattern
+		r.params = params
+	}
+	if len(method) <= 0 {
+		r.handler = handler
+	} else {
+		r.methods[method] = handler
+	}
+	return r
 }
-*/
 
-type TrieNode struct {
-	Path    string
-	Handler func(Context) //root handler 为默认处理器
-	Next    map[string]TrieNode
+// findRoute 按注册时的路径查找路由, 占位符名称不参与比较, 未找到则返回 nil
+func (this *TrieNode) findRoute(pattern string) *route {
+	segments := splitPath(pattern)
+	isPrefix := false
+	if segments[len(segments)-1] == "" {
+		isPrefix = true
+		segments = segments[:len(segments)-1]
+	}
+	node := this
+	for _, segment := range segments {
+		if _, isParam := pathParamName(segment); isParam {
+			node = node.param
+		} else {
+			node = node.Next[segment]
+		}
+		if node == nil {
+			return nil
+		}
+	}
+	if isPrefix {
+		return node.prefix
+	}
+	return node.exact
 }
 
-func NewTrieNode(defaultHandler func(Context)) TrieNode {
-	return TrieNode{
-		Path:    "/",
-		Handler: defaultHandler,
-		Next:    map[string]TrieNode{},
+// methodHandler 获取http方法对应处理器
+//
+// HEAD 未注册时使用 GET 处理器, 均未注册时使用匹配所有方法的处理器
+func (r *route) methodHandler(method string) HandlerFunc {
+	if handler, has := r.methods[method]; has {
+		return handler
+	}
+	if method == HEAD {
+		if handler, has := r.methods[GET]; has {
+			return handler
+		}
 	}
+	return r.handler
 }
 
-func (this TrieNode) AddPath(path string, handler func(Context)) {
-	if strings.HasSuffix(path, "/") {
-		path = path[0 : len(path)-1]
+// routeMethods Allow 头中http方法的顺序
+var routeMethods = []string{GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS}
+
+// allow 返回该路由支持的http方法, 用于 Allow 头
+func (r *route) allow() string {
+	if r.handler != nil {
+		return strings.Join(routeMethods, ", ")
 	}
-	if strings.HasPrefix(path, "/") {
-		path = path[1:]
+	var res []string
+	for _, method := range routeMethods {
+		if r.methodHandler(method) != nil || method == OPTIONS {
+			res = append(res, method)
+		}
 	}
-	paths := strings.Split(path, "/")
-	addNext(paths, handler, this)
+	var others []string
+	for method := range r.methods {
+		if !isRouteMethod(method) {
+			others = append(others, method)
+		}
+	}
+	sort.Strings(others)
+	return strings.Join(append(res, others...), ", ")
 }
 
-func addNext(paths []string, handler func(Context), node TrieNode) {
-	if len(paths) <= 0 {
-		return
+// lookup 查找路径对应路由及路径参数, 未找到则返回 nil
+func (this *TrieNode) lookup(path string) (*route, map[string]string) {
+	r, values := this.match(splitPath(path), nil)
+	if r == nil {
+		return nil, nil
 	}
-	path := paths[0]
-	if node.Next == nil {
-		node.Next = map[string]TrieNode{}
+	pathParams := make(map[string]string, len(r.params))
+	for i, name := range r.params {
+		pathParams[name] = values[i]
 	}
-	org, has := node.Next[path]
-	if len(paths) == 1 {
-		// 开始做事
-		if has {
-			org.Handler = handler
-		} else {
-			node.Next[path] = TrieNode{
-				Path:    path,
-				Handler: handler,
-			}
+	return r, pathParams
+}
+
+func (this *TrieNode) match(segments []string, values []string) (*route, []string) {
+	if len(segments) <= 0 {
+		if this.exact != nil {
+			return this.exact, values
 		}
-		return
+		return nil, nil
 	}
-	if !has {
-		node.Next[path] = TrieNode{
-			Path: path,
-			Next: map[string]TrieNode{},
+	segment := segments[0]
+	if child, has := this.Next[segment]; has {
+		if r, res := child.match(segments[1:], values); r != nil {
+			return r, res
 		}
-		addNext(paths[1:], handler, node.Next[path])
-	} else {
-		addNext(paths[1:], handler, node.Next[path])
 	}
+	if this.param != nil && len(segment) > 0 {
+		if r, res := this.param.match(segments[1:], append(values, segment)); r != nil {
+			return r, res
+		}
+	}
+	if this.prefix != nil {
+		return this.prefix, values
+	}
+	return nil, nil
 }
 
-func (this TrieNode) FindPath(path string) func(Context) {
-	if strings.HasSuffix(path, "/") {
-		path = path[0 : len(path)-1]
-	}
-	if strings.HasPrefix(path, "/") {
-		path = path[1:]
+func isRouteMethod(method string) bool {
+	for _, m := range routeMethods {
+		if m == method {
+			return true
+		}
 	}
-	paths := strings.Split(path, "/")
-	return findNext(paths, this)
+	return false
 }
 
-func findNext(paths []string, root TrieNode) func(Context) {
-	if len(paths) <= 0 {
-		return nil
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	path := paths[0]
-	org, has := root.Next[path]
-	if len(paths) == 1 {
-		if has {
-			return org.Handler
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
-		return root.Handler
 	}
-	if !has {
-		return root.Handler
+	return true
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// pathParamName 判断分段是否为 {占位符}, 并返回参数名
+func pathParamName(segment string) (string, bool) {
+	if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
 	}
-	return findNext(paths[1:], org)
+	return "", false
 }
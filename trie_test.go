@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrieNodePriority(t *testing.T) {
+	root := NewTrieNode(nil)
+	root.addRoute("/api/", "", func(*Context) {})
+	root.addRoute("/api/user/{id}", "", func(*Context) {})
+	root.addRoute("/api/user/info", "", func(*Context) {})
+	root.addRoute("/api/{group}/{id}/detail", "", func(*Context) {})
+
+	cases := map[string]string{
+		"/api/user/info":       "/api/user/info",
+		"/api/user/12":         "/api/user/{id}",
+		"/api/order/12/detail": "/api/{group}/{id}/detail",
+		"/api/user/12/detail":  "/api/{group}/{id}/detail",
+		"/api/user":            "/api/",
+		"/api/":                "/api/",
+		"/api/user/12/13":      "/api/",
+		"/api":                 "",
+		"/other":               "",
+	}
+	for i := 0; i < 20; i++ {
+		for path, pattern := range cases {
+			r, _ := root.lookup(path)
+			if pattern == "" {
+				if r != nil {
+					t.Fatalf("%v should not match, got %v", path, r.pattern)
+				}
+				continue
+			}
+			if r == nil || r.pattern != pattern {
+				t.Fatalf("%v should match %v, got %v", path, pattern, r)
+			}
+		}
+	}
+}
+
+func TestTrieNodePathParams(t *testing.T) {
+	root := NewTrieNode(nil)
+	root.addRoute("/{a}/{b}/{c}/{d}/{e}/{f}/{g}/{h}/{i}/{j}/{k}/{l}", "", func(*Context) {})
+	_, params := root.lookup("/1/2/3/4/5/6/7/8/9/10/11/12")
+	if len(params) != 12 || params["a"] != "1" || params["l"] != "12" {
+		t.Fatalf("path params error: %v", params)
+	}
+}
+
+func TestServerMethodRoute(t *testing.T) {
+	srv := NewServer("", 0)
+	srv.CrossDomain = false
+	srv.GET("/user/{id}", func(c Context) {
+		c.OK(Plain, []byte("get "+c.GetPathParam("id")))
+	})
+	srv.POST("/user/{id}", func(c Context) {
+		c.OK(Plain, []byte("post "+c.GetPathParam("id")))
+	})
+
+	cases := []struct {
+		method string
+		code   int
+		body   string
+		allow  string
+	}{
+		{GET, StatusOK, "get 1", ""},
+		{POST, StatusOK, "post 1", ""},
+		{HEAD, StatusOK, "", ""},
+		{DELETE, StatusMethodNotAllowed, "", "GET, HEAD, POST, OPTIONS"},
+		{OPTIONS, StatusNoContent, "", "GET, HEAD, POST, OPTIONS"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(c.method, "/user/1", nil))
+		if w.Code != c.code {
+			t.Fatalf("%v: code %v, want %v", c.method, w.Code, c.code)
+		}
+		if len(c.body) > 0 && w.Body.String() != c.body {
+			t.Fatalf("%v: body %v, want %v", c.method, w.Body.String(), c.body)
+		}
+		if w.Header().Get(Allow) != c.allow {
+			t.Fatalf("%v: allow %v, want %v", c.method, w.Header().Get(Allow), c.allow)
+		}
+	}
+}
@@ -0,0 +1,472 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// UploadConfig 文件上传限制, 通过 UploadLimit 中间件按路由设置
+type UploadConfig struct {
+	// MaxBodySize 请求体最大字节数, 0 则不限制
+	MaxBodySize int64
+
+	// MaxFiles 最多文件数, 0 则不限制
+	MaxFiles int
+
+	// MaxFileSize 单个文件最大字节数, 0 则不限制
+	MaxFileSize int64
+
+	// MaxMemory 非文件字段占用的最大内存, FormFile 解析时超出部分写入临时文件, 默认 BindMaxMemory
+	MaxMemory int64
+
+	// AllowExtensions 允许的扩展名, 如 .png, 为空则不限制
+	AllowExtensions []string
+
+	// AllowMimeTypes 允许的文件类型, 根据文件内容识别, 支持 image/* 形式, 为空则不限制
+	AllowMimeTypes []string
+
+	// Checksum 保存时计算 sha256
+	Checksum bool
+}
+
+// UploadError 上传错误, Code 为建议返回的http状态码
+type UploadError struct {
+	Code    int
+	Message string
+}
+
+func (e *UploadError) Error() string {
+	return e.Message
+}
+
+// UploadErrorCode 上传错误对应的http状态码
+func UploadErrorCode(err error) int {
+	var uploadErr *UploadError
+	if errors.As(err, &uploadErr) {
+		return uploadErr.Code
+	}
+	return StatusBadRequest
+}
+
+func uploadError(err error) error {
+	if _, ok := err.(*UploadError); ok {
+		return err
+	}
+	// 请求体及 multipart 超出限制时的错误
+	if errors.Is(err, errUploadBodyTooLarge) || errors.Is(err, multipart.ErrMessageTooLarge) {
+		return &UploadError{Code: StatusRequestEntityTooLarge, Message: "请求体超出大小限制"}
+	}
+	return &UploadError{Code: StatusBadRequest, Message: err.Error()}
+}
+
+// UploadedFile 已保存的上传文件
+type UploadedFile struct {
+	// Field 表单字段名
+	Field string
+
+	// Filename 客户端提交的文件名
+	Filename string
+
+	// Path 保存路径
+	Path string
+
+	// Size 文件字节数
+	Size int64
+
+	// ContentType 根据文件内容识别的类型
+	ContentType string
+
+	// Checksum sha256 十六进制, 未开启 Checksum 时为空
+	Checksum string
+
+	// Header 文件对应的 multipart 头
+	Header textproto.MIMEHeader
+}
+
+// UploadResult SaveUploads 结果
+type UploadResult struct {
+	Files  []*UploadedFile
+	Values url.Values
+}
+
+// File 获取字段对应的第一个文件
+func (r *UploadResult) File(field string) *UploadedFile {
+	for _, file := range r.Files {
+		if file.Field == field {
+			return file
+		}
+	}
+	return nil
+}
+
+// Remove 删除已保存的文件
+func (r *UploadResult) Remove() {
+	for _, file := range r.Files {
+		_ = os.Remove(file.Path)
+	}
+}
+
+// UploadLimit 设置路由的上传限制, Content-Length 超出 MaxBodySize 时直接返回 413
+//
+//	srv.POST("/upload", handler, UploadLimit(UploadConfig{MaxBodySize: 100 << 20, MaxFiles: 5}))
+func UploadLimit(conf UploadConfig) Middleware {
+	return func(ctx *Context, next func()) {
+		if conf.MaxBodySize > 0 && ctx.Request.ContentLength > conf.MaxBodySize {
+			ctx.Error(StatusRequestEntityTooLarge, "请求体超出大小限制")
+			return
+		}
+		ctx.SetUploadConfig(conf)
+		next()
+	}
+}
+
+// SetUploadConfig 设置当前请求的上传限制, 需在读取请求体前调用
+func (c *Context) SetUploadConfig(conf UploadConfig) {
+	if conf.MaxBodySize > 0 {
+		c.Request.Body = &limitedBody{ReadCloser: c.Request.Body, limit: conf.MaxBodySize}
+	}
+	c.upload = &conf
+}
+
+var errUploadBodyTooLarge = errors.New("请求体超出大小限制")
+
+// limitedBody 限制读取的请求体字节数, 超出时返回 errUploadBodyTooLarge
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.read > b.limit {
+		return 0, errUploadBodyTooLarge
+	}
+	if int64(len(p)) > b.limit-b.read+1 {
+		p = p[:b.limit-b.read+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return n - int(b.read-b.limit), errUploadBodyTooLarge
+	}
+	return n, err
+}
+
+func (c *Context) uploadConfig() *UploadConfig {
+	if c.upload != nil {
+		return c.upload
+	}
+	return &UploadConfig{}
+}
+
+// SaveUploads 流式读取 multipart 请求体, 将文件依次写入 dir, 文件不会完整读入内存
+//
+// 非文件字段存入 UploadResult.Values, 出错时删除已保存的文件, 错误状态码可通过 UploadErrorCode 获取
+func (c *Context) SaveUploads(dir string) (*UploadResult, error) {
+	if len(dir) <= 0 {
+		return nil, errors.New("上传目录不能为空")
+	}
+	conf := c.uploadConfig()
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, uploadError(err)
+	}
+	result := &UploadResult{Values: url.Values{}}
+	remaining := conf.maxMemory()
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			result.Remove()
+			return nil, uploadError(err)
+		}
+		field := part.FormName()
+		if len(field) <= 0 {
+			_ = part.Close()
+			continue
+		}
+		filename := part.FileName()
+		if len(filename) <= 0 {
+			value, err := ioutil.ReadAll(io.LimitReader(part, remaining+1))
+			_ = part.Close()
+			if err != nil {
+				result.Remove()
+				return nil, uploadError(err)
+			}
+			remaining -= int64(len(value))
+			if remaining < 0 {
+				result.Remove()
+				return nil, &UploadError{Code: StatusRequestEntityTooLarge, Message: "表单字段超出大小限制"}
+			}
+			result.Values.Add(field, string(value))
+			continue
+		}
+		if conf.MaxFiles > 0 && len(result.Files) >= conf.MaxFiles {
+			_ = part.Close()
+			result.Remove()
+			return nil, &UploadError{Code: StatusRequestEntityTooLarge, Message: fmt.Sprintf("文件数超出限制: %d", conf.MaxFiles)}
+		}
+		file, err := conf.save(part, filename, dir)
+		_ = part.Close()
+		if err != nil {
+			result.Remove()
+			return nil, err
+		}
+		file.Field = field
+		file.Header = part.Header
+		result.Files = append(result.Files, file)
+	}
+}
+
+// FormFile 获取表单文件, 超出 MaxMemory 的部分写入临时文件, 并按上传限制校验所有文件
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	files, err := c.MultipartFiles()
+	if err != nil {
+		return nil, err
+	}
+	if headers := files[name]; len(headers) > 0 {
+		return headers[0], nil
+	}
+	return nil, http.ErrMissingFile
+}
+
+// MultipartFiles 获取所有表单文件, 超出 MaxMemory 的部分写入临时文件, 并按上传限制校验所有文件
+func (c *Context) MultipartFiles() (map[string][]*multipart.FileHeader, error) {
+	conf := c.uploadConfig()
+	if err := c.Request.ParseMultipartForm(conf.maxMemory()); err != nil {
+		return nil, uploadError(err)
+	}
+	files := c.Request.MultipartForm.File
+	count := 0
+	for _, headers := range files {
+		for _, header := range headers {
+			count++
+			if err := conf.check(header); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if conf.MaxFiles > 0 && count > conf.MaxFiles {
+		return nil, &UploadError{Code: StatusRequestEntityTooLarge, Message: fmt.Sprintf("文件数超出限制: %d", conf.MaxFiles)}
+	}
+	return files, nil
+}
+
+// SaveFormFile 将 FormFile 获取的文件保存至 dir
+func (c *Context) SaveFormFile(header *multipart.FileHeader, dir string) (*UploadedFile, error) {
+	src, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	file, err := c.uploadConfig().save(src, header.Filename, dir)
+	if err != nil {
+		return nil, err
+	}
+	file.Header = header.Header
+	return file, nil
+}
+
+func (conf *UploadConfig) maxMemory() int64 {
+	if conf.MaxMemory > 0 {
+		return conf.MaxMemory
+	}
+	return BindMaxMemory
+}
+
+// check 校验已解析的表单文件
+func (conf *UploadConfig) check(header *multipart.FileHeader) error {
+	if conf.MaxFileSize > 0 && header.Size > conf.MaxFileSize {
+		return &UploadError{Code: StatusRequestEntityTooLarge, Message: "文件超出大小限制: " + header.Filename}
+	}
+	if err := conf.checkExtension(SanitizeFilename(header.Filename)); err != nil {
+		return err
+	}
+	if len(conf.AllowMimeTypes) <= 0 {
+		return nil
+	}
+	src, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	head, err := readHead(src)
+	if err != nil {
+		return uploadError(err)
+	}
+	return conf.checkMime(http.DetectContentType(head))
+}
+
+func (conf *UploadConfig) checkExtension(name string) error {
+	if len(conf.AllowExtensions) <= 0 {
+		return nil
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, allow := range conf.AllowExtensions {
+		allow = strings.ToLower(allow)
+		if !strings.HasPrefix(allow, ".") {
+			allow = "." + allow
+		}
+		if allow == ext {
+			return nil
+		}
+	}
+	return &UploadError{Code: StatusUnsupportedMediaType, Message: "不允许的文件扩展名: " + name}
+}
+
+func (conf *UploadConfig) checkMime(contentType string) error {
+	if len(conf.AllowMimeTypes) <= 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	for _, allow := range conf.AllowMimeTypes {
+		allow = strings.ToLower(allow)
+		if allow == "*/*" || allow == mediaType ||
+			(strings.HasSuffix(allow, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allow, "*"))) {
+			return nil
+		}
+	}
+	return &UploadError{Code: StatusUnsupportedMediaType, Message: "不允许的文件类型: " + mediaType}
+}
+
+func readHead(src io.Reader) ([]byte, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(src, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return head[:n], err
+}
+
+// save 校验并流式写入文件, 超出限制时删除已写入的内容
+func (conf *UploadConfig) save(src io.Reader, filename string, dir string) (*UploadedFile, error) {
+	name := SanitizeFilename(filename)
+	if err := conf.checkExtension(name); err != nil {
+		return nil, err
+	}
+	head, err := readHead(src)
+	if err != nil {
+		return nil, uploadError(err)
+	}
+	contentType := http.DetectContentType(head)
+	if err = conf.checkMime(contentType); err != nil {
+		return nil, err
+	}
+	dst, err := createUploadFile(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	reader := io.MultiReader(bytes.NewReader(head), src)
+	if conf.MaxFileSize > 0 {
+		reader = io.LimitReader(reader, conf.MaxFileSize+1)
+	}
+	var writer io.Writer = dst
+	hash := sha256.New()
+	if conf.Checksum {
+		writer = io.MultiWriter(dst, hash)
+	}
+	size, err := io.Copy(writer, reader)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && conf.MaxFileSize > 0 && size > conf.MaxFileSize {
+		err = &UploadError{Code: StatusRequestEntityTooLarge, Message: "文件超出大小限制: " + name}
+	}
+	if err != nil {
+		_ = os.Remove(dst.Name())
+		return nil, uploadError(err)
+	}
+	file := &UploadedFile{
+		Filename:    filename,
+		Path:        dst.Name(),
+		Size:        size,
+		ContentType: contentType,
+	}
+	if conf.Checksum {
+		file.Checksum = hex.EncodeToString(hash.Sum(nil))
+	}
+	return file, nil
+}
+
+// createUploadFile 在 dir 下创建文件, 重名时添加序号, 不覆盖已有文件
+func createUploadFile(dir string, name string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; i < 10000; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+		file, err := os.OpenFile(filepath.Join(dir, candidate), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		return file, err
+	}
+	return nil, errors.New("无法创建上传文件: " + name)
+}
+
+// windowsReserved windows 保留文件名
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFilename 清理客户端提交的文件名
+//
+// 去除路径, 控制字符及 <>:"/\|?* 等字符, 去除首尾的空格及点, 限制长度为200字节, 结果为空时返回 file
+func SanitizeFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if index := strings.LastIndex(name, "/"); index >= 0 {
+		name = name[index+1:]
+	}
+	builder := strings.Builder{}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || r == utf8.RuneError || strings.ContainsRune(`<>:"/\|?*`, r) {
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	name = strings.Trim(builder.String(), " .")
+	if len(name) > 200 {
+		ext := filepath.Ext(name)
+		if len(ext) > 20 {
+			ext = ""
+		}
+		base := name[:200-len(ext)]
+		for len(base) > 0 && !utf8.RuneStart(name[len(base)]) {
+			base = base[:len(base)-1]
+		}
+		name = strings.TrimRight(base, " .") + ext
+	}
+	if len(name) <= 0 {
+		return "file"
+	}
+	if windowsReserved[strings.ToUpper(strings.TrimSuffix(name, filepath.Ext(name)))] {
+		name = "_" + name
+	}
+	return name
+}
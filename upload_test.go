@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type uploadPart struct {
+	field    string
+	filename string
+	content  string
+}
+
+func multipartRequest(t *testing.T, parts ...uploadPart) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, part := range parts {
+		if len(part.filename) <= 0 {
+			_ = writer.WriteField(part.field, part.content)
+			continue
+		}
+		w, err := writer.CreateFormFile(part.field, part.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(part.content))
+	}
+	_ = writer.Close()
+	return body, writer.FormDataContentType()
+}
+
+func TestSaveUploads(t *testing.T) {
+	dir := t.TempDir()
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("p", 100)
+	srv := NewServer("", 0)
+	srv.POST("/upload", func(c Context) {
+		result, err := c.SaveUploads(dir)
+		if err != nil {
+			c.Error(UploadErrorCode(err), err.Error())
+			return
+		}
+		c.OK(Plain, []byte(result.Values.Get("name")+":"+result.File("image").Checksum))
+	}, UploadLimit(UploadConfig{
+		MaxBodySize:     4096,
+		MaxFiles:        2,
+		MaxFileSize:     1024,
+		AllowExtensions: []string{"png", ".TXT"},
+		AllowMimeTypes:  []string{"image/*", "text/plain"},
+		Checksum:        true,
+	}))
+
+	upload := func(parts ...uploadPart) *httptest.ResponseRecorder {
+		body, contentType := multipartRequest(t, parts...)
+		req := httptest.NewRequest(POST, "/upload", body)
+		req.Header.Set(ContentType, contentType)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	w := upload(uploadPart{field: "name", content: "avatar"}, uploadPart{field: "image", filename: "../../a.png", content: png},
+		uploadPart{field: "image", filename: "a.png", content: png})
+	sum := sha256.Sum256([]byte(png))
+	if w.Code != StatusOK || w.Body.String() != "avatar:"+hex.EncodeToString(sum[:]) {
+		t.Fatalf("upload error: %v %v", w.Code, w.Body.String())
+	}
+	for _, name := range []string{"a.png", "a-1.png"} {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != png {
+			t.Fatalf("saved file error: %v %v", name, err)
+		}
+	}
+
+	for _, c := range []struct {
+		parts []uploadPart
+		code  int
+	}{
+		{[]uploadPart{{"f", "a.exe", "text"}}, StatusUnsupportedMediaType},
+		{[]uploadPart{{"image", "a.png", "%PDF-1.4 document"}}, StatusUnsupportedMediaType},
+		{[]uploadPart{{"f", "b.txt", strings.Repeat("x", 2000)}}, StatusRequestEntityTooLarge},
+		{[]uploadPart{{"f", "c.txt", "1"}, {"f", "d.txt", "2"}, {"f", "e.txt", "3"}}, StatusRequestEntityTooLarge},
+		{[]uploadPart{{"f", "g.txt", "1"}, {"f", "h.txt", strings.Repeat("x", 1000)}, {"n", "", strings.Repeat("x", 4000)}}, StatusRequestEntityTooLarge},
+	} {
+		if w = upload(c.parts...); w.Code != c.code {
+			t.Fatalf("upload limit error: %v %v %v", c.parts[0].filename, w.Code, w.Body.String())
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Fatalf("failed uploads not removed: %v", len(files))
+	}
+}
+
+func TestFormFile(t *testing.T) {
+	dir := t.TempDir()
+	srv := NewServer("", 0)
+	srv.POST("/upload", func(c Context) {
+		header, err := c.FormFile("doc")
+		if err != nil {
+			c.Error(UploadErrorCode(err), err.Error())
+			return
+		}
+		file, err := c.SaveFormFile(header, dir)
+		if err != nil {
+			c.Error(UploadErrorCode(err), err.Error())
+			return
+		}
+		c.OK(Plain, []byte(filepath.Base(file.Path)))
+	}, UploadLimit(UploadConfig{MaxFileSize: 10}))
+
+	body, contentType := multipartRequest(t, uploadPart{"doc", `C:\tmp\CON.txt`, "hello"})
+	req := httptest.NewRequest(POST, "/upload", body)
+	req.Header.Set(ContentType, contentType)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != StatusOK || w.Body.String() != "_CON.txt" {
+		t.Fatalf("form file error: %v %v", w.Code, w.Body.String())
+	}
+
+	body, contentType = multipartRequest(t, uploadPart{"doc", "big.txt", "hello world"})
+	req = httptest.NewRequest(POST, "/upload", body)
+	req.Header.Set(ContentType, contentType)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != StatusRequestEntityTooLarge {
+		t.Fatalf("form file limit error: %v", w.Code)
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	for name, expected := range map[string]string{
+		"../../etc/passwd":                "passwd",
+		`..\..\boot.ini`:                  "boot.ini",
+		"  .hidden. ":                     "hidden",
+		"a<b>c:d\"e|f?g*h\x00.txt":        "abcdefgh.txt",
+		"..":                              "file",
+		"":                                "file",
+		"nul.txt":                         "_nul.txt",
+		strings.Repeat("文", 100) + ".txt": strings.Repeat("文", 65) + ".txt",
+	} {
+		if res := SanitizeFilename(name); res != expected {
+			t.Fatalf("sanitize %q error: %q", name, res)
+		}
+	}
+}
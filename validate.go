@@ -0,0 +1,275 @@
+package middleware
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError 字段校验错误
+type FieldError struct {
+	// Field 字段名称, 优先使用 json, form 等 tag 中的名称, 嵌套结构体以 . 分隔
+	Field string `json:"field"`
+
+	// Rule 校验规则: required, min, max, len, regex, enum, email, type
+	Rule string `json:"rule"`
+
+	// Param 校验规则参数
+	Param string `json:"param"`
+
+	// Message 错误信息
+	Message string `json:"message"`
+}
+
+// ValidationErrors 校验错误列表
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		messages = append(messages, fieldError.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidateMessages 校验错误信息模板, 可进行全局修改
+//
+// ${field}: 字段名称, ${param}: 规则参数
+//
+// 开启i18n时优先使用 message 配置中 validate.${rule} 对应的模板
+var ValidateMessages = map[string]string{
+	"required": "${field} 不能为空",
+	"min":      "${field} 不能小于 ${param}",
+	"max":      "${field} 不能大于 ${param}",
+	"len":      "${field} 长度需为 ${param}",
+	"regex":    "${field} 格式错误",
+	"enum":     "${field} 需为 ${param} 其中之一",
+	"email":    "${field} 不是合法的邮箱地址",
+	"type":     "${field} 类型错误, 需为 ${param}",
+}
+
+var emailReg = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+
+var validateRegCache = sync.Map{}
+
+/*
+Validate 按 validate tag 校验结构体, 校验通过返回 nil
+
+多个规则以 , 分隔, regex 需为最后一个规则:
+
+	validate:"required,min=1,max=10,len=6,enum=a|b|c,email,regex=^\d+$"
+
+min, max, len 对字符串及切片校验长度, 对数字校验大小; 非 required 字段为零值时不进行其他校验
+*/
+func Validate(obj interface{}) ValidationErrors {
+	value := reflect.ValueOf(obj)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs ValidationErrors
+	validateStruct(value, "", &errs)
+	if len(errs) <= 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateStruct(value reflect.Value, prefix string, errs *ValidationErrors) {
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if len(field.PkgPath) > 0 && !field.Anonymous {
+			continue
+		}
+		fieldValue := value.Field(i)
+		name := prefix + fieldName(field)
+		if field.Anonymous {
+			name = prefix
+		}
+		if rules := field.Tag.Get("validate"); len(rules) > 0 && rules != "-" {
+			validateField(fieldValue, name, rules, errs)
+		}
+		nested := fieldValue
+		if nested.Kind() == reflect.Ptr && !nested.IsNil() {
+			nested = nested.Elem()
+		}
+		if nested.Kind() == reflect.Struct && nested.Type() != timeType {
+			if !field.Anonymous {
+				name = name + "."
+			}
+			validateStruct(nested, name, errs)
+		}
+	}
+}
+
+func validateField(value reflect.Value, name string, rules string, errs *ValidationErrors) {
+	required := false
+	var parsed [][2]string
+	for len(rules) > 0 {
+		var rule string
+		if strings.HasPrefix(rules, "regex=") {
+			rule, rules = rules, ""
+		} else if index := strings.Index(rules, ","); index >= 0 {
+			rule, rules = rules[:index], rules[index+1:]
+		} else {
+			rule, rules = rules, ""
+		}
+		rule = strings.TrimSpace(rule)
+		if len(rule) <= 0 {
+			continue
+		}
+		ruleName, param := rule, ""
+		if index := strings.Index(rule, "="); index >= 0 {
+			ruleName, param = rule[:index], rule[index+1:]
+		}
+		if ruleName == "required" {
+			required = true
+		}
+		parsed = append(parsed, [2]string{ruleName, param})
+	}
+	if isZeroValue(value) {
+		if required {
+			*errs = append(*errs, newFieldError(name, "required", ""))
+		}
+		return
+	}
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	for _, rule := range parsed {
+		if !checkRule(value, rule[0], rule[1]) {
+			*errs = append(*errs, newFieldError(name, rule[0], rule[1]))
+		}
+	}
+}
+
+func isZeroValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() <= 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+	return value.IsZero()
+}
+
+func checkRule(value reflect.Value, rule string, param string) bool {
+	switch rule {
+	case "required":
+		return true
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			mLogger.ErrorF("validate 规则参数错误: %v=%v", rule, param)
+			return true
+		}
+		size, ok := ruleSize(value, rule == "len")
+		if !ok {
+			return true
+		}
+		switch rule {
+		case "min":
+			return size >= limit
+		case "max":
+			return size <= limit
+		default:
+			return size == limit
+		}
+	case "regex":
+		reg, err := validateReg(param)
+		if err != nil {
+			mLogger.ErrorF("validate 正则错误: %v, %v", param, err.Error())
+			return true
+		}
+		return reg.MatchString(fmt.Sprintf("%v", value.Interface()))
+	case "enum":
+		str := fmt.Sprintf("%v", value.Interface())
+		for _, item := range strings.Split(param, "|") {
+			if item == str {
+				return true
+			}
+		}
+		return false
+	case "email":
+		return value.Kind() == reflect.String && emailReg.MatchString(value.String())
+	}
+	mLogger.ErrorF("不支持的 validate 规则: %v", rule)
+	return true
+}
+
+// ruleSize 字符串及切片返回长度, 数字返回值
+func ruleSize(value reflect.Value, lengthOnly bool) (float64, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), true
+	}
+	if lengthOnly {
+		return 0, false
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+func validateReg(expr string) (*regexp.Regexp, error) {
+	if reg, has := validateRegCache.Load(expr); has {
+		return reg.(*regexp.Regexp), nil
+	}
+	reg, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	validateRegCache.Store(expr, reg)
+	return reg, nil
+}
+
+func newFieldError(field string, rule string, param string) FieldError {
+	return FieldError{
+		Field:   field,
+		Rule:    rule,
+		Param:   param,
+		Message: formatValidateMessage(ValidateMessages[rule], field, param),
+	}
+}
+
+func formatValidateMessage(tpl string, field string, param string) string {
+	return StringFormatMap(tpl, map[string]string{
+		"field": field,
+		"param": param,
+	})
+}
+
+// translateErrors 开启i18n时使用 validate.${rule} 配置翻译错误信息
+func (c *Context) translateErrors(errs ValidationErrors) ValidationErrors {
+	if !c.EnableI18n {
+		return errs
+	}
+	message := c.Message.Cn
+	if locale := c.Locale(); len(locale) > 0 && locale != "cn" {
+		message = c.Message.En
+	}
+	for i, fieldError := range errs {
+		if tpl, has := message[fmt.Sprintf("validate.%s", fieldError.Rule)]; has {
+			errs[i].Message = formatValidateMessage(tpl, fieldError.Field, fieldError.Param)
+		}
+	}
+	return errs
+}
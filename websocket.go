@@ -1,189 +1,481 @@
 package middleware
 
 import (
-	"flag"
-	"html/template"
-	"io/ioutil"
-	"log"
+	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
-	"strconv"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// websocket 消息类型
 const (
-	// Time allowed to write the file to the client.
-	writeWait = 10 * time.Second
+	WebsocketText   = websocket.TextMessage
+	WebsocketBinary = websocket.BinaryMessage
+)
 
-	// Time allowed to read the next pong message from the client.
-	pongWait = 60 * time.Second
+// ErrWebsocketClosed 连接已关闭
+var ErrWebsocketClosed = errors.New("websocket 连接已关闭")
 
-	// Send pings to client with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
+// WebsocketConfig websocket 配置
+type WebsocketConfig struct {
+	// AllowOrigins 允许的来源, * 表示允许所有来源, 为空且未设置 CheckOrigin 时只允许同源请求
+	AllowOrigins []string
 
-	// Poll file for changes with this period.
-	filePeriod = 10 * time.Second
-)
+	// CheckOrigin 自定义来源校验, 设置后忽略 AllowOrigins
+	CheckOrigin func(r *http.Request) bool
+
+	// ReadLimit 单条消息最大字节数, 超出时断开连接
+	ReadLimit int64
+
+	// PingInterval 发送 ping 的间隔, 需小于 PongWait
+	PingInterval time.Duration
+
+	// PongWait 等待 pong 或消息的最长时间, 超时断开连接
+	PongWait time.Duration
+
+	// WriteWait 单条消息写入超时时间
+	WriteWait time.Duration
+
+	// SendBuffer 发送缓冲消息数, 缓冲已满时断开连接, 避免慢客户端阻塞广播
+	SendBuffer int
+
+	// Subprotocols 支持的子协议
+	Subprotocols []string
+
+	// EnableCompression 开启 permessage-deflate 压缩
+	EnableCompression bool
+
+	// Hub 连接建立后自动加入的 hub, 为空则不加入
+	Hub *WebsocketHub
+}
+
+// DefaultWebsocketConfig 默认 websocket 配置
+var DefaultWebsocketConfig = WebsocketConfig{
+	ReadLimit:    64 << 10,
+	PingInterval: 54 * time.Second,
+	PongWait:     60 * time.Second,
+	WriteWait:    10 * time.Second,
+	SendBuffer:   64,
+}
+
+type websocketMessage struct {
+	typ  int
+	data []byte
+}
+
+// WebsocketConn websocket 连接
+//
+// 读取需在处理器中进行, 发送可在任意协程中进行, 处理器返回后连接自动关闭
+type WebsocketConn struct {
+	// Id 连接id
+	Id string
 
-var (
-	addr      = flag.String("addr", ":8080", "http service address")
-	homeTempl = template.Must(template.New("").Parse(homeHTML))
-	filename  string
-	upgrader  = websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
+	// User 连接对应的用户, 可在处理器中设置, 用于在线列表
+	User string
+
+	ctx       Context
+	conn      *websocket.Conn
+	conf      WebsocketConfig
+	hub       *WebsocketHub
+	send      chan websocketMessage
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Context 建立连接的http请求
+func (c *WebsocketConn) Context() *Context {
+	return &c.ctx
+}
+
+// Read 读取一条消息, 返回消息类型及内容
+func (c *WebsocketConn) Read() (int, []byte, error) {
+	typ, data, err := c.conn.ReadMessage()
+	if err == nil {
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.conf.PongWait))
 	}
-)
+	return typ, data, err
+}
 
-func readFileIfModified(lastMod time.Time) ([]byte, time.Time, error) {
-	fi, err := os.Stat(filename)
+// ReadJSON 读取一条json消息
+func (c *WebsocketConn) ReadJSON(v interface{}) error {
+	_, data, err := c.Read()
 	if err != nil {
-		return nil, lastMod, err
+		return err
 	}
-	if !fi.ModTime().After(lastMod) {
-		return nil, lastMod, nil
+	return json.Unmarshal(data, v)
+}
+
+// Send 发送消息, 发送缓冲已满时断开连接
+func (c *WebsocketConn) Send(messageType int, data []byte) error {
+	select {
+	case <-c.done:
+		return ErrWebsocketClosed
+	default:
+	}
+	select {
+	case c.send <- websocketMessage{typ: messageType, data: data}:
+		return nil
+	case <-c.done:
+		return ErrWebsocketClosed
+	default:
+		mLogger.WarnF("websocket 发送缓冲已满, 断开连接: %s", c.Id)
+		c.Close()
+		return errors.New("websocket 发送缓冲已满")
 	}
-	p, err := ioutil.ReadFile(filename)
+}
+
+// SendText 发送文本消息
+func (c *WebsocketConn) SendText(text string) error {
+	return c.Send(WebsocketText, []byte(text))
+}
+
+// SendJSON 发送json消息
+func (c *WebsocketConn) SendJSON(v interface{}) error {
+	data, err := json.Marshal(v)
 	if err != nil {
-		return nil, fi.ModTime(), err
+		return err
 	}
-	return p, fi.ModTime(), nil
+	return c.Send(WebsocketText, data)
 }
 
-func reader(ws *websocket.Conn) {
-	defer ws.Close()
-	ws.SetReadLimit(512)
-	ws.SetReadDeadline(time.Now().Add(pongWait))
-	ws.SetPongHandler(func(string) error { ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
-	for {
-		_, _, err := ws.ReadMessage()
-		if err != nil {
-			break
+// Done 连接关闭时关闭
+func (c *WebsocketConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close 关闭连接, 离开所有房间并触发 hub 断开回调
+func (c *WebsocketConn) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.hub != nil {
+			c.hub.remove(c)
 		}
+	})
+}
+
+// Join 加入房间, 未设置 hub 时忽略
+func (c *WebsocketConn) Join(room string) {
+	if c.hub != nil {
+		c.hub.Join(room, c)
+	}
+}
+
+// Leave 离开房间
+func (c *WebsocketConn) Leave(room string) {
+	if c.hub != nil {
+		c.hub.Leave(room, c)
 	}
 }
 
-func writer(ws *websocket.Conn, lastMod time.Time) {
-	lastError := ""
-	pingTicker := time.NewTicker(pingPeriod)
-	fileTicker := time.NewTicker(filePeriod)
+// writeLoop 串行写入消息并定时发送 ping
+func (c *WebsocketConn) writeLoop() {
+	ticker := time.NewTicker(c.conf.PingInterval)
 	defer func() {
-		pingTicker.Stop()
-		fileTicker.Stop()
-		ws.Close()
+		ticker.Stop()
+		_ = c.conn.Close()
 	}()
 	for {
 		select {
-		case <-fileTicker.C:
-			var p []byte
-			var err error
-
-			p, lastMod, err = readFileIfModified(lastMod)
-
-			if err != nil {
-				if s := err.Error(); s != lastError {
-					lastError = s
-					p = []byte(lastError)
-				}
-			} else {
-				lastError = ""
-			}
-
-			if p != nil {
-				ws.SetWriteDeadline(time.Now().Add(writeWait))
-				if err := ws.WriteMessage(websocket.TextMessage, p); err != nil {
-					return
-				}
+		case message := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.conf.WriteWait))
+			if err := c.conn.WriteMessage(message.typ, message.data); err != nil {
+				c.Close()
+				return
 			}
-		case <-pingTicker.C:
-			ws.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := ws.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.conf.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.Close()
 				return
 			}
+		case <-c.done:
+			_ = c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(c.conf.WriteWait))
+			return
 		}
 	}
 }
 
-func serveWs(w http.ResponseWriter, r *http.Request) {
-	ws, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		if _, ok := err.(websocket.HandshakeError); !ok {
-			log.Println(err)
-		}
-		return
+// WebsocketHub websocket 连接管理, 支持房间, 广播, 在线列表及断开回调
+type WebsocketHub struct {
+	conns        map[string]*WebsocketConn
+	rooms        map[string]map[string]*WebsocketConn
+	connRooms    map[string]map[string]struct{}
+	onDisconnect []func(conn *WebsocketConn)
+	sync.RWMutex
+}
+
+// NewWebsocketHub 创建 websocket hub
+func NewWebsocketHub() *WebsocketHub {
+	return &WebsocketHub{
+		conns:     map[string]*WebsocketConn{},
+		rooms:     map[string]map[string]*WebsocketConn{},
+		connRooms: map[string]map[string]struct{}{},
 	}
+}
 
-	var lastMod time.Time
-	if n, err := strconv.ParseInt(r.FormValue("lastMod"), 16, 64); err == nil {
-		lastMod = time.Unix(0, n)
+// OnDisconnect 注册连接断开回调, 回调时连接已离开所有房间
+func (h *WebsocketHub) OnDisconnect(callback func(conn *WebsocketConn)) {
+	if callback == nil {
+		return
 	}
+	h.Lock()
+	defer h.Unlock()
+	h.onDisconnect = append(h.onDisconnect, callback)
+}
 
-	go writer(ws, lastMod)
-	reader(ws)
+func (h *WebsocketHub) add(conn *WebsocketConn) {
+	h.Lock()
+	defer h.Unlock()
+	conn.hub = h
+	h.conns[conn.Id] = conn
 }
 
-func serveHome(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.Error(w, "Not found", http.StatusNotFound)
+func (h *WebsocketHub) remove(conn *WebsocketConn) {
+	h.Lock()
+	if _, has := h.conns[conn.Id]; !has {
+		h.Unlock()
 		return
 	}
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	delete(h.conns, conn.Id)
+	for room := range h.connRooms[conn.Id] {
+		h.leave(room, conn)
+	}
+	delete(h.connRooms, conn.Id)
+	callbacks := h.onDisconnect
+	h.Unlock()
+	for _, callback := range callbacks {
+		runWebsocketCallback(callback, conn)
+	}
+}
+
+func runWebsocketCallback(callback func(conn *WebsocketConn), conn *WebsocketConn) {
+	defer func() {
+		if err := recover(); err != nil {
+			mLogger.ErrorF("websocket disconnect callback error: %v", err)
+		}
+	}()
+	callback(conn)
+}
+
+// Join 连接加入房间
+func (h *WebsocketHub) Join(room string, conn *WebsocketConn) {
+	h.Lock()
+	defer h.Unlock()
+	if _, has := h.conns[conn.Id]; !has {
 		return
 	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	p, lastMod, err := readFileIfModified(time.Time{})
+	if h.rooms[room] == nil {
+		h.rooms[room] = map[string]*WebsocketConn{}
+	}
+	h.rooms[room][conn.Id] = conn
+	if h.connRooms[conn.Id] == nil {
+		h.connRooms[conn.Id] = map[string]struct{}{}
+	}
+	h.connRooms[conn.Id][room] = struct{}{}
+}
+
+// Leave 连接离开房间
+func (h *WebsocketHub) Leave(room string, conn *WebsocketConn) {
+	h.Lock()
+	defer h.Unlock()
+	h.leave(room, conn)
+	delete(h.connRooms[conn.Id], room)
+}
+
+func (h *WebsocketHub) leave(room string, conn *WebsocketConn) {
+	members := h.rooms[room]
+	delete(members, conn.Id)
+	if len(members) <= 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// Broadcast 向所有连接发送消息
+func (h *WebsocketHub) Broadcast(messageType int, data []byte) {
+	h.RLock()
+	conns := make([]*WebsocketConn, 0, len(h.conns))
+	for _, conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.RUnlock()
+	broadcast(conns, messageType, data, nil)
+}
+
+// BroadcastRoom 向房间内的连接发送消息, except 不为空时跳过该连接
+func (h *WebsocketHub) BroadcastRoom(room string, messageType int, data []byte, except *WebsocketConn) {
+	broadcast(h.Presence(room), messageType, data, except)
+}
+
+// BroadcastJSON 向房间内的连接发送json消息, room 为空则发送给所有连接
+func (h *WebsocketHub) BroadcastJSON(room string, v interface{}) error {
+	data, err := json.Marshal(v)
 	if err != nil {
-		p = []byte(err.Error())
-		lastMod = time.Unix(0, 0)
-	}
-	var v = struct {
-		Host    string
-		Data    string
-		LastMod string
-	}{
-		r.Host,
-		string(p),
-		strconv.FormatInt(lastMod.UnixNano(), 16),
-	}
-	homeTempl.Execute(w, &v)
-}
-
-func WebsocketMain() {
-	flag.Parse()
-	if flag.NArg() != 1 {
-		log.Fatal("filename not specified")
-	}
-	filename = flag.Args()[0]
-	http.HandleFunc("/", serveHome)
-	http.HandleFunc("/ws", serveWs)
-	if err := http.ListenAndServe(*addr, nil); err != nil {
-		log.Fatal(err)
-	}
-}
-
-const homeHTML = `<!DOCTYPE html>
-<html lang="en">
-    <head>
-        <title>WebSocket Example</title>
-    </head>
-    <body>
-        <pre id="fileData">{{.Data}}</pre>
-        <script type="text/javascript">
-            (function() {
-                var data = document.getElementById("fileData");
-                var conn = new WebSocket("ws://{{.Host}}/ws?lastMod={{.LastMod}}");
-                conn.onclose = function(evt) {
-                    data.textContent = 'Connection closed';
-                }
-                conn.onmessage = function(evt) {
-                    console.log('file updated');
-                    data.textContent = evt.data;
-                }
-            })();
-        </script>
-    </body>
-</html>
-`
+		return err
+	}
+	if len(room) <= 0 {
+		h.Broadcast(WebsocketText, data)
+		return nil
+	}
+	h.BroadcastRoom(room, WebsocketText, data, nil)
+	return nil
+}
+
+func broadcast(conns []*WebsocketConn, messageType int, data []byte, except *WebsocketConn) {
+	for _, conn := range conns {
+		if conn != except {
+			_ = conn.Send(messageType, data)
+		}
+	}
+}
+
+// Presence 房间内的连接, 按连接id排序
+func (h *WebsocketHub) Presence(room string) []*WebsocketConn {
+	h.RLock()
+	members := h.rooms[room]
+	res := make([]*WebsocketConn, 0, len(members))
+	for _, conn := range members {
+		res = append(res, conn)
+	}
+	h.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Id < res[j].Id
+	})
+	return res
+}
+
+// Rooms 连接所在的房间
+func (h *WebsocketHub) Rooms(conn *WebsocketConn) []string {
+	h.RLock()
+	defer h.RUnlock()
+	var res []string
+	for room := range h.connRooms[conn.Id] {
+		res = append(res, room)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Count 当前连接数
+func (h *WebsocketHub) Count() int {
+	h.RLock()
+	defer h.RUnlock()
+	return len(h.conns)
+}
+
+// Get 按连接id获取连接
+func (h *WebsocketHub) Get(id string) *WebsocketConn {
+	h.RLock()
+	defer h.RUnlock()
+	return h.conns[id]
+}
+
+// WebsocketHandler 将 websocket 处理器转换为http处理器, 可注册至 Server 或 Group
+func WebsocketHandler(conf WebsocketConfig, handler func(conn *WebsocketConn)) func(Context) {
+	conf = websocketConfig(conf)
+	upgrader := websocket.Upgrader{
+		Subprotocols:      conf.Subprotocols,
+		EnableCompression: conf.EnableCompression,
+		CheckOrigin:       websocketCheckOrigin(conf),
+	}
+	return func(context Context) {
+		if !context.writeable {
+			return
+		}
+		ws, err := upgrader.Upgrade(context.Response, context.Request, nil)
+		// Upgrade 失败时已写入错误响应
+		context.writeable = false
+		if err != nil {
+			mLogger.WarnF("websocket upgrade error: %v, %v", context.Request.URL.Path, err.Error())
+			return
+		}
+		context.code = StatusSwitchingProtocols
+		ws.SetReadLimit(conf.ReadLimit)
+		_ = ws.SetReadDeadline(time.Now().Add(conf.PongWait))
+		ws.SetPongHandler(func(string) error {
+			return ws.SetReadDeadline(time.Now().Add(conf.PongWait))
+		})
+		conn := &WebsocketConn{
+			Id:   randomHex(8),
+			ctx:  context,
+			conn: ws,
+			conf: conf,
+			send: make(chan websocketMessage, conf.SendBuffer),
+			done: make(chan struct{}),
+		}
+		if conf.Hub != nil {
+			conf.Hub.add(conn)
+		}
+		go conn.writeLoop()
+		defer conn.Close()
+		handler(conn)
+	}
+}
+
+func websocketConfig(conf WebsocketConfig) WebsocketConfig {
+	if conf.ReadLimit <= 0 {
+		conf.ReadLimit = DefaultWebsocketConfig.ReadLimit
+	}
+	if conf.PongWait <= 0 {
+		conf.PongWait = DefaultWebsocketConfig.PongWait
+	}
+	if conf.PingInterval <= 0 || conf.PingInterval >= conf.PongWait {
+		conf.PingInterval = conf.PongWait * 9 / 10
+	}
+	if conf.WriteWait <= 0 {
+		conf.WriteWait = DefaultWebsocketConfig.WriteWait
+	}
+	if conf.SendBuffer <= 0 {
+		conf.SendBuffer = DefaultWebsocketConfig.SendBuffer
+	}
+	return conf
+}
+
+func websocketCheckOrigin(conf WebsocketConfig) func(r *http.Request) bool {
+	if conf.CheckOrigin != nil {
+		return conf.CheckOrigin
+	}
+	if len(conf.AllowOrigins) <= 0 {
+		// 使用 gorilla 默认的同源校验
+		return nil
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get(Origin)
+		if len(origin) <= 0 {
+			return true
+		}
+		for _, allow := range conf.AllowOrigins {
+			if allow == "*" || strings.EqualFold(allow, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RegisterWebsocket 注册 websocket 处理器, 使用 DefaultWebsocketConfig
+//
+// 握手请求为 GET 请求, 会经过中间件及过滤器, 可在过滤器中进行认证
+func (t *Server) RegisterWebsocket(path string, handler func(conn *WebsocketConn)) *SwaggerPath {
+	return t.RegisterWebsocketWithConfig(path, DefaultWebsocketConfig, handler)
+}
+
+// RegisterWebsocketWithConfig 按配置注册 websocket 处理器
+func (t *Server) RegisterWebsocketWithConfig(path string, conf WebsocketConfig, handler func(conn *WebsocketConn)) *SwaggerPath {
+	return t.GET(path, WebsocketHandler(conf, handler))
+}
+
+// RegisterWebsocket 在全局Server注册 websocket 处理器
+func RegisterWebsocket(path string, handler func(conn *WebsocketConn)) *SwaggerPath {
+	return globalServer.RegisterWebsocket(path, handler)
+}
+
+// RegisterWebsocketWithConfig 在全局Server按配置注册 websocket 处理器
+func RegisterWebsocketWithConfig(path string, conf WebsocketConfig, handler func(conn *WebsocketConn)) *SwaggerPath {
+	return globalServer.RegisterWebsocketWithConfig(path, conf, handler)
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialWebsocket(t *testing.T, url string, header http.Header) *websocket.Conn {
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), header)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial error: %v, status: %v", err, status)
+	}
+	return conn
+}
+
+func TestWebsocketHub(t *testing.T) {
+	hub := NewWebsocketHub()
+	disconnected := make(chan string, 4)
+	hub.OnDisconnect(func(conn *WebsocketConn) {
+		if len(hub.Rooms(conn)) > 0 {
+			t.Errorf("rooms not left on disconnect: %v", hub.Rooms(conn))
+		}
+		disconnected <- conn.User
+	})
+
+	srv := NewServer("", 0)
+	srv.RegisterFilter("/ws", func(c Context) bool {
+		if c.GetQueryParam("token") != "ok" {
+			c.Error(StatusUnauthorized, "unauthorized")
+			return false
+		}
+		return true
+	})
+	srv.RegisterWebsocketWithConfig("/ws", WebsocketConfig{Hub: hub}, func(conn *WebsocketConn) {
+		conn.User = conn.Context().GetQueryParam("user")
+		conn.Join("lobby")
+		for {
+			var message map[string]string
+			if err := conn.ReadJSON(&message); err != nil {
+				return
+			}
+			hub.BroadcastRoom("lobby", WebsocketText, []byte(conn.User+":"+message["text"]), conn)
+		}
+	})
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	if _, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil); err == nil || resp.StatusCode != StatusUnauthorized {
+		t.Fatalf("filter not applied: %v", err)
+	}
+	header := http.Header{}
+	header.Set(Origin, "http://evil.example")
+	if _, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?token=ok", header); err == nil || resp.StatusCode != StatusForbidden {
+		t.Fatalf("origin not checked: %v", err)
+	}
+
+	alice := dialWebsocket(t, server.URL+"/ws?token=ok&user=alice", nil)
+	bob := dialWebsocket(t, server.URL+"/ws?token=ok&user=bob", nil)
+	defer bob.Close()
+	for i := 0; i < 100 && len(hub.Presence("lobby")) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(hub.Presence("lobby")) != 2 || hub.Count() != 2 {
+		t.Fatalf("presence error: %v", len(hub.Presence("lobby")))
+	}
+
+	if err := alice.WriteJSON(map[string]string{"text": "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = bob.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := bob.ReadMessage()
+	if err != nil || string(data) != "alice:hi" {
+		t.Fatalf("broadcast error: %q, %v", data, err)
+	}
+
+	_ = alice.Close()
+	select {
+	case user := <-disconnected:
+		if user != "alice" {
+			t.Fatalf("disconnect user error: %v", user)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("disconnect callback not called")
+	}
+	if presence := hub.Presence("lobby"); len(presence) != 1 || presence[0].User != "bob" {
+		t.Fatalf("presence after disconnect error: %v", len(presence))
+	}
+}
+
+func TestWebsocketReadLimit(t *testing.T) {
+	closed := make(chan error, 1)
+	srv := NewServer("", 0)
+	srv.RegisterWebsocketWithConfig("/ws", WebsocketConfig{ReadLimit: 16}, func(conn *WebsocketConn) {
+		_, _, err := conn.Read()
+		closed <- err
+	})
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	conn := dialWebsocket(t, server.URL+"/ws", nil)
+	defer conn.Close()
+	_ = conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 64)))
+	select {
+	case err := <-closed:
+		if err != websocket.ErrReadLimit {
+			t.Fatalf("read limit error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("read limit not applied")
+	}
+}